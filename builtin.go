@@ -0,0 +1,26 @@
+package main
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+//go:embed builtin/*.rainbow
+var builtinFS embed.FS
+
+// builtinConfigs contains the configs built into the binary.
+var builtinConfigs, _ = fs.Sub(builtinFS, "builtin")
+
+// Paths of built-in configs are their file names with this prefix.
+const builtinConfigPrefix = "builtin:"
+
+// openConfig opens a config file, which may be built-in.
+func openConfig(path string) (io.ReadCloser, error) {
+	if name, ok := strings.CutPrefix(path, builtinConfigPrefix); ok {
+		return builtinConfigs.Open(name)
+	}
+	return os.Open(path)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestBuiltinConfigs(t *testing.T) {
+	files, err := fs.ReadDir(builtinConfigs, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no built-in configs")
+	}
+	for _, file := range files {
+		prog, err := loadProgram(builtinConfigPrefix + file.Name())
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, warning := range prog.check("") {
+			t.Errorf("%s: %s", file.Name(), warning)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// charset decodes input text of a character set to UTF-8.
+type charset struct {
+	name  string
+	runes *[128]rune // Runes of bytes 0x80-0xff, nil for UTF-8
+}
+
+var charsetUTF8 = &charset{name: "utf-8"}
+
+var charsets = func() map[string]*charset {
+	latin1 := &charset{name: "latin1", runes: new([128]rune)}
+	for i := range latin1.runes {
+		latin1.runes[i] = rune(0x80 + i)
+	}
+
+	// Windows-1252 is Latin-1 with printable characters instead of C1 control
+	// codes. Five bytes are undefined.
+	cp1252 := &charset{name: "cp1252", runes: new([128]rune)}
+	*cp1252.runes = *latin1.runes
+	copy(cp1252.runes[:], []rune{
+		'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+		utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+	})
+
+	return map[string]*charset{
+		"utf-8":        charsetUTF8,
+		"utf8":         charsetUTF8,
+		"latin1":       latin1,
+		"iso-8859-1":   latin1,
+		"cp1252":       cp1252,
+		"windows-1252": cp1252,
+	}
+}()
+
+// findCharset finds a character set by name, ignoring case.
+func findCharset(name string) (*charset, error) {
+	if cs, ok := charsets[strings.ToLower(name)]; ok {
+		return cs, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q, expected utf-8, latin1 or cp1252", name)
+}
+
+// decode returns text converted to UTF-8 and the intervals of the converted
+// text that replace invalid input. Text that needs no conversion is returned as
+// is.
+func (cs *charset) decode(text []byte) ([]byte, []interval) {
+	if cs.runes == nil && utf8.Valid(text) || cs.runes != nil && isASCII(text) {
+		return text, nil
+	}
+
+	out := make([]byte, 0, len(text)+len(text)/2)
+	var invalid []interval
+	for i := 0; i < len(text); {
+		r, size := rune(text[i]), 1
+		if r >= utf8.RuneSelf {
+			if cs.runes == nil {
+				r, size = utf8.DecodeRune(text[i:])
+			} else {
+				r = cs.runes[text[i]-0x80]
+			}
+		}
+		beg := len(out)
+		out = utf8.AppendRune(out, r)
+		if r == utf8.RuneError && size == 1 {
+			if n := len(invalid); n > 0 && invalid[n-1].end == beg {
+				invalid[n-1].end = len(out)
+			} else {
+				invalid = append(invalid, interval{beg: beg, end: len(out)})
+			}
+		}
+		i += size
+	}
+	return out, invalid
+}
+
+// trimIncomplete removes a character at the end of text that may continue in
+// input not yet read.
+func (cs *charset) trimIncomplete(text []byte) []byte {
+	if cs.runes != nil {
+		return text
+	}
+	for i := len(text) - 1; i >= 0 && i > len(text)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(text[i]) {
+			if !utf8.FullRune(text[i:]) {
+				return text[:i]
+			}
+			break
+		}
+	}
+	return text
+}
+
+func isASCII(text []byte) bool {
+	for _, c := range text {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCharsetDecode(t *testing.T) {
+	tests := []struct {
+		charset string
+		input   string
+		want    string
+		invalid []interval
+	}{
+		{"utf-8", "abc", "abc", nil},
+		{"utf-8", "åäö", "åäö", nil},
+		{"utf-8", "a\xff\xfeb\xc3", "a��b�", []interval{{1, 7}, {8, 11}}},
+		{"latin1", "abc", "abc", nil},
+		{"latin1", "\xe5\xe4\xf6\x80", "åäö\u0080", nil},
+		{"cp1252", "\x80 \x93x\x94", "€ “x”", nil},
+		{"cp1252", "a\x81b", "a�b", []interval{{1, 4}}},
+	}
+
+	for _, test := range tests {
+		cs, err := findCharset(test.charset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, invalid := cs.decode([]byte(test.input))
+		if string(got) != test.want || fmt.Sprint(invalid) != fmt.Sprint(test.invalid) {
+			t.Errorf("%s %q: got %q %v, want %q %v", test.charset, test.input, got, invalid, test.want, test.invalid)
+		}
+	}
+}
+
+func TestCharsetTrimIncomplete(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"ab", "ab"},
+		{"a\xc3", "a"},
+		{"a\xe2\x82", "a"},
+		{"a\xe2\x82\xac", "a\xe2\x82\xac"},
+		{"a\xff", "a\xff"},
+	}
+
+	for _, test := range tests {
+		if got := string(charsetUTF8.trimIncomplete([]byte(test.input))); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
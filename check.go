@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"github.com/johan-bolmsjo/rainbow/internal/igor"
+	"github.com/johan-bolmsjo/saft"
+	"sort"
+)
+
+// check reports likely mistakes in the program that are not errors. Some of
+// them would otherwise only show up when a matching line arrives. Warnings are
+// located in configFile, the config file the program was loaded from, unless
+// in an included config file. The file is left out if configFile is empty.
+func (prog *program) check(configFile string) []error {
+	var warnings []error
+
+	// Filters are referenced by apply clauses, including all of their nested
+	// filters, and by other filters using their regexp.
+	referenced := map[*filter]bool{}
+	var markApplied func(f *filter)
+	markApplied = func(f *filter) {
+		referenced[f] = true
+		f.filters.apply(markApplied)
+	}
+	for _, stm := range prog.stms {
+		stm.filters.apply(markApplied)
+	}
+
+	var markRegexpFrom func(f *filter)
+	markRegexpFrom = func(f *filter) {
+		if f.regexpFrom != nil {
+			referenced[f.regexpFrom] = true
+		}
+		f.filters.apply(markRegexpFrom)
+	}
+	prog.filters.apply(markRegexpFrom)
+
+	var checkFilter func(f *filter, parentReferenced bool)
+	checkFilter = func(f *filter, parentReferenced bool) {
+		// Only report the outermost unreferenced filter.
+		if !referenced[f] && parentReferenced {
+			if f.name == "" {
+				warnings = append(warnings, warningf(cmp.Or(f.file, configFile), f.pos, "unnamed filter is never applied"))
+			} else {
+				warnings = append(warnings, warningf(cmp.Or(f.file, configFile), f.pos, "filter %q is never applied or referenced", f.name))
+			}
+		}
+
+		if re := f.matchRegexp(); re != nil {
+			var groups []int
+			for group := range f.props {
+				groups = append(groups, group)
+			}
+			sort.Ints(groups)
+			for _, group := range groups {
+				if group > re.NumSubexp() {
+					warnings = append(warnings, warningf(cmp.Or(f.file, configFile), f.groupPos[group],
+						"regexp group %d does not exist, the regexp has %d groups", group, re.NumSubexp()))
+				}
+			}
+		} else if len(f.props) > 0 {
+			warnings = append(warnings, warningf(cmp.Or(f.file, configFile), f.pos, "filter has properties but no regexp"))
+		}
+
+		for _, nested := range f.filters {
+			checkFilter(nested, referenced[f])
+		}
+	}
+	for _, f := range prog.filters {
+		checkFilter(f, true)
+	}
+
+	for _, stm := range prog.stms {
+		stm.cond.Walk(func(call igor.Call) {
+			var names []igor.Object
+			switch call.Name {
+			case "filter-match?":
+				names = call.Args
+			case "filter-result":
+				if len(call.Args) > 0 {
+					names = call.Args[:1]
+				}
+			}
+			for _, name := range names {
+				if name, ok := name.(igor.ObjectString); ok && prog.findFilter(string(name)) == nil {
+					warnings = append(warnings, warningf(cmp.Or(stm.file, configFile), call.Pos, "%s: filter %q does not exist", call.Name, string(name)))
+				}
+			}
+		})
+	}
+
+	var unused []*style
+	for _, s := range prog.styles {
+		if !s.used {
+			unused = append(unused, s)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].name < unused[j].name })
+	for _, s := range unused {
+		warnings = append(warnings, warningf(cmp.Or(s.file, configFile), s.pos, "style %q is never used", s.name))
+	}
+
+	return warnings
+}
+
+// warningf formats a warning at pos in file, the file is left out if empty.
+func warningf(file string, pos saft.LexPos, format string, a ...interface{}) error {
+	err := posErrorf(pos, "warning: "+format, a...)
+	if file != "" {
+		err = decorateErrorWithSource(err, file)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+)
+
+// colorMode selects when output is colored.
+type colorMode uint8
+
+const (
+	colorAuto   colorMode = iota // Color output to terminals, unless overridden by the environment
+	colorAlways                  // Always color output
+	colorNever                   // Never color output
+)
+
+func parseColorMode(s string) (colorMode, error) {
+	switch s {
+	case "auto":
+		return colorAuto, nil
+	case "always":
+		return colorAlways, nil
+	case "never":
+		return colorNever, nil
+	}
+	return colorAuto, fmt.Errorf("invalid color mode %q, expected auto, always or never", s)
+}
+
+// colorEnabled reports if output is to be colored. Unless color is forced on
+// or off by mode, the environment is consulted in order of precedence:
+//
+//   - NO_COLOR set to anything but the empty string disables color
+//   - CLICOLOR_FORCE or FORCE_COLOR set to anything but the empty string, "0"
+//     or "false" enables color
+//   - CLICOLOR set to "0" disables color
+//   - TERM set to "dumb" disables color
+//
+// Otherwise output is colored if written to a terminal.
+func colorEnabled(mode colorMode, getenv func(string) string, terminal bool) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	for _, name := range []string{"CLICOLOR_FORCE", "FORCE_COLOR"} {
+		if v := getenv(name); v != "" && v != "0" && v != "false" {
+			return true
+		}
+	}
+	if getenv("CLICOLOR") == "0" || getenv("TERM") == "dumb" {
+		return false
+	}
+	return terminal
+}
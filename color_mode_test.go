@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		mode     colorMode
+		env      map[string]string
+		terminal bool
+		want     bool
+	}{
+		{colorAuto, nil, true, true},
+		{colorAuto, nil, false, false},
+		{colorAlways, map[string]string{"NO_COLOR": "1"}, false, true},
+		{colorNever, map[string]string{"FORCE_COLOR": "1"}, true, false},
+		{colorAuto, map[string]string{"NO_COLOR": "1"}, true, false},
+		{colorAuto, map[string]string{"NO_COLOR": "1", "FORCE_COLOR": "1"}, true, false},
+		{colorAuto, map[string]string{"FORCE_COLOR": "1"}, false, true},
+		{colorAuto, map[string]string{"FORCE_COLOR": "0"}, false, false},
+		{colorAuto, map[string]string{"CLICOLOR_FORCE": "1", "TERM": "dumb"}, false, true},
+		{colorAuto, map[string]string{"CLICOLOR": "0"}, true, false},
+		{colorAuto, map[string]string{"CLICOLOR": "1"}, false, false},
+		{colorAuto, map[string]string{"TERM": "dumb"}, true, false},
+	}
+
+	for _, test := range tests {
+		getenv := func(name string) string { return test.env[name] }
+		if got := colorEnabled(test.mode, getenv, test.terminal); got != test.want {
+			t.Errorf("mode %d, env %v, terminal %v: got %v, want %v", test.mode, test.env, test.terminal, got, test.want)
+		}
+	}
+}
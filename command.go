@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// command is a child process whose stdout and stderr are read as separate
+// input sources named "stdout" and "stderr".
+type command struct {
+	cmd          *exec.Cmd
+	sources      []*inputSource
+	signals      chan os.Signal
+	handleSignal func(sig os.Signal)
+}
+
+func startCommand(args []string) (*command, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep running until the child exits to not lose any of its output. An
+	// interrupt from the terminal is delivered to the child as well.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	if err = cmd.Start(); err != nil {
+		signal.Stop(signals)
+		return nil, err
+	}
+
+	c := &command{
+		cmd: cmd,
+		sources: []*inputSource{
+			newPipeSource("stdout", stdout),
+			newPipeSource("stderr", stderr),
+		},
+		signals: signals,
+	}
+	c.handleSignal = func(sig os.Signal) {
+		if sig != os.Interrupt {
+			c.cmd.Process.Signal(sig)
+		}
+	}
+	go c.forwardSignals()
+	return c, nil
+}
+
+func newPipeSource(name string, pipe io.ReadCloser) *inputSource {
+	return newInputSource(name, func() (io.ReadCloser, error) {
+		return pipe, nil
+	})
+}
+
+func (c *command) forwardSignals() {
+	for sig := range c.signals {
+		c.handleSignal(sig)
+	}
+}
+
+// wait waits for the child to exit and reports its exit code. A child killed
+// by a signal is reported like shells do, as 128 plus the signal number.
+func (c *command) wait() (int, error) {
+	err := c.cmd.Wait()
+	signal.Stop(c.signals)
+	close(c.signals)
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+
+	state := c.cmd.ProcessState
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return state.ExitCode(), nil
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// startCommandPTY starts a command with a pseudo-terminal as its controlling
+// terminal, making programs that check if their output is a terminal keep line
+// buffering and colors. The stdout and stderr of the command can not be told
+// apart and are read as a single input source named "stdout". Stdin is copied
+// to the command.
+func startCommandPTY(args []string) (*command, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+
+	resizePTY(master)
+
+	// The command runs in its own session, signals generated by the terminal
+	// are only delivered to rainbow and must be forwarded.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGWINCH)
+
+	if err = cmd.Start(); err != nil {
+		signal.Stop(signals)
+		master.Close()
+		return nil, err
+	}
+
+	c := &command{
+		cmd:     cmd,
+		sources: []*inputSource{newPipeSource("stdout", ptyReader{master})},
+		signals: signals,
+	}
+	c.handleSignal = func(sig os.Signal) {
+		if sig == syscall.SIGWINCH {
+			resizePTY(master)
+		} else {
+			c.cmd.Process.Signal(sig)
+		}
+	}
+	go c.forwardSignals()
+
+	go func() {
+		io.Copy(master, os.Stdin)
+		// Signal end of file to the command.
+		master.Write([]byte{4})
+	}()
+
+	return c, nil
+}
+
+// openPTY opens a new pseudo-terminal pair. Echo of input and translation of
+// newlines to CR-LF are disabled as rainbow is processing the output.
+func openPTY() (master, slave *os.File, err error) {
+	if master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0); err != nil {
+		return nil, nil, err
+	}
+	fd := int(master.Fd())
+
+	var n int
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err == nil {
+		n, err = unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	}
+	if err == nil {
+		slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var termios *unix.Termios
+	if termios, err = unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS); err == nil {
+		termios.Lflag &^= unix.ECHO
+		termios.Oflag &^= unix.ONLCR
+		err = unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios)
+	}
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// resizePTY copies the window size of the terminal rainbow is running in to
+// the pseudo-terminal. Nothing is done if rainbow is not running in a
+// terminal.
+func resizePTY(master *os.File) {
+	for _, f := range []*os.File{os.Stdout, os.Stdin, os.Stderr} {
+		if ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ); err == nil {
+			unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, ws)
+			return
+		}
+	}
+}
+
+// ptyReader reads from a pseudo-terminal master. Reading fails with EIO when
+// all processes using the terminal have exited, which is reported as end of
+// file.
+type ptyReader struct {
+	*os.File
+}
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	if errors.Is(err, syscall.EIO) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func startCommandPTY(args []string) (*command, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Linux")
+}
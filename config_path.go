@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const configSuffix = ".rainbow"
+
+// configDir is a directory searched for config files.
+type configDir struct {
+	path   string
+	origin string // Where the directory was found, e.g. "user"
+	fsys   fs.FS  // Built-in configs, nil for directories of the OS
+}
+
+// configEntry is a config file found in the config search path.
+type configEntry struct {
+	name string
+	path string
+	dir  *configDir
+}
+
+// configSearchPath returns the directories searched for config files in order
+// of precedence:
+//
+//   - ".rainbow" directories of the current directory and its parents, nearest first
+//   - $XDG_CONFIG_HOME/rainbow, defaulting to ~/.config/rainbow
+//   - rainbow in each of $XDG_CONFIG_DIRS, defaulting to /etc/xdg/rainbow
+//   - configs built into the binary
+func configSearchPath() []*configDir {
+	var dirs []*configDir
+
+	if cwd, err := os.Getwd(); err == nil {
+		for dir := cwd; ; {
+			path := filepath.Join(dir, ".rainbow")
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				dirs = append(dirs, &configDir{path: path, origin: "project"})
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+
+	if dir, err := userConfigDir(); err == nil {
+		dirs = append(dirs, &configDir{path: filepath.Join(dir, "rainbow"), origin: "user"})
+	}
+
+	for _, dir := range systemConfigDirs() {
+		dirs = append(dirs, &configDir{path: filepath.Join(dir, "rainbow"), origin: "system"})
+	}
+
+	dirs = append(dirs, &configDir{path: builtinConfigPrefix, origin: "builtin", fsys: builtinConfigs})
+
+	return dirs
+}
+
+// file returns the path of the named file in the directory.
+func (dir *configDir) file(name string) string {
+	if dir.fsys != nil {
+		return dir.path + name
+	}
+	return filepath.Join(dir.path, name)
+}
+
+func (dir *configDir) stat(name string) (fs.FileInfo, error) {
+	if dir.fsys != nil {
+		return fs.Stat(dir.fsys, name)
+	}
+	return os.Stat(dir.file(name))
+}
+
+func (dir *configDir) readDir() ([]fs.DirEntry, error) {
+	if dir.fsys != nil {
+		return fs.ReadDir(dir.fsys, ".")
+	}
+	return os.ReadDir(dir.path)
+}
+
+// userConfigDir returns $XDG_CONFIG_HOME or its default ~/.config.
+func userConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	if dir := os.Getenv("HOME"); dir != "" {
+		return filepath.Join(dir, ".config"), nil
+	}
+	return os.UserConfigDir()
+}
+
+// systemConfigDirs returns $XDG_CONFIG_DIRS or its default /etc/xdg.
+func systemConfigDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("XDG_CONFIG_DIRS")) {
+		// Relative paths are invalid according to the XDG specification.
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 && filepath.Separator == '/' {
+		dirs = append(dirs, "/etc/xdg")
+	}
+	return dirs
+}
+
+// resolveConfig finds the config file named name in the config search path.
+func resolveConfig(name string) (string, error) {
+	dirs := configSearchPath()
+	for _, dir := range dirs {
+		if info, err := dir.stat(name + configSuffix); err == nil && !info.IsDir() {
+			return dir.file(name + configSuffix), nil
+		}
+	}
+
+	var searched []string
+	for _, dir := range dirs {
+		if dir.fsys != nil {
+			searched = append(searched, "built-in configs")
+		} else {
+			searched = append(searched, dir.path)
+		}
+	}
+	return "", fmt.Errorf("config %q not found in %s", name, strings.Join(searched, ", "))
+}
+
+// findConfigs returns all config files in the config search path. Configs are
+// sorted by name and then by precedence.
+func findConfigs() []*configEntry {
+	var configs []*configEntry
+	for _, dir := range configSearchPath() {
+		files, err := dir.readDir()
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if name, ok := strings.CutSuffix(file.Name(), configSuffix); ok && !file.IsDir() {
+				configs = append(configs, &configEntry{
+					name: name,
+					path: dir.file(file.Name()),
+					dir:  dir,
+				})
+			}
+		}
+	}
+	sort.SliceStable(configs, func(i, j int) bool {
+		return configs[i].name < configs[j].name
+	})
+	return configs
+}
+
+// listConfigs writes all config files in the config search path to w. Configs
+// shadowed by configs with the same name and higher precedence are marked.
+func listConfigs(w io.Writer) error {
+	configs := findConfigs()
+
+	width := 0
+	for _, c := range configs {
+		width = max(width, len(c.name))
+	}
+
+	var active *configEntry
+	for _, c := range configs {
+		var err error
+		if active == nil || active.name != c.name {
+			active = c
+			_, err = fmt.Fprintf(w, "%-*s  %s (%s)\n", width, c.name, c.path, c.dir.origin)
+		} else {
+			_, err = fmt.Fprintf(w, "%-*s  %s (%s, shadowed by %s)\n", width, c.name, c.path, c.dir.origin, active.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveInclude finds a config file included by the config file includedBy.
+// Relative names are searched for relative to includedBy, unless empty, and
+// then in the config search path. The config suffix may be left out.
+func resolveInclude(name, includedBy string) (string, error) {
+	names := []string{name}
+	if !strings.HasSuffix(name, configSuffix) {
+		names = append(names, name+configSuffix)
+	}
+
+	var dirs []*configDir
+	if filepath.IsAbs(name) {
+		dirs = append(dirs, &configDir{})
+	} else {
+		if strings.HasPrefix(includedBy, builtinConfigPrefix) {
+			dirs = append(dirs, &configDir{path: builtinConfigPrefix, fsys: builtinConfigs})
+		} else if includedBy != "" {
+			dirs = append(dirs, &configDir{path: filepath.Dir(includedBy)})
+		}
+		dirs = append(dirs, configSearchPath()...)
+	}
+
+	for _, dir := range dirs {
+		for _, name := range names {
+			if info, err := dir.stat(name); err == nil && !info.IsDir() {
+				return dir.file(name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("included config %q not found", name)
+}
+
+// sameConfigFile reports if two config file paths refer to the same file.
+func sameConfigFile(a, b string) bool {
+	if strings.HasPrefix(a, builtinConfigPrefix) || strings.HasPrefix(b, builtinConfigPrefix) {
+		return a == b
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSearchPath(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := func(elem ...string) string {
+		return filepath.Join(append([]string{root}, elem...)...)
+	}
+	writeConfigs := func(dir string, names ...string) {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name+configSuffix), []byte("{}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeConfigs(dir("project", "sub", ".rainbow"), "a")
+	writeConfigs(dir("project", ".rainbow"), "a", "p")
+	writeConfigs(dir("xdg", "rainbow"), "a", "b")
+	writeConfigs(dir("sys1", "rainbow"), "a", "b", "c")
+	writeConfigs(dir("sys2", "rainbow"), "c", "gotest")
+	cwd := dir("project", "sub", "deeper")
+	writeConfigs(filepath.Join(cwd, "relative", "rainbow"), "d")
+
+	t.Setenv("XDG_CONFIG_HOME", dir("xdg"))
+	t.Setenv("XDG_CONFIG_DIRS", strings.Join([]string{"relative", dir("sys1"), dir("sys2")}, string(filepath.ListSeparator)))
+	t.Chdir(cwd)
+
+	var got []string
+	for _, d := range configSearchPath() {
+		got = append(got, d.origin+" "+d.path)
+	}
+	want := []string{
+		"project " + dir("project", "sub", ".rainbow"),
+		"project " + dir("project", ".rainbow"),
+		"user " + dir("xdg", "rainbow"),
+		"system " + dir("sys1", "rainbow"),
+		"system " + dir("sys2", "rainbow"),
+		"builtin " + builtinConfigPrefix,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got search path\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{"a", dir("project", "sub", ".rainbow", "a.rainbow")},
+		{"p", dir("project", ".rainbow", "p.rainbow")},
+		{"b", dir("xdg", "rainbow", "b.rainbow")},
+		{"c", dir("sys1", "rainbow", "c.rainbow")},
+		{"gotest", dir("sys2", "rainbow", "gotest.rainbow")},
+		{"diff", builtinConfigPrefix + "diff.rainbow"},
+		{"d", ""}, // Relative entries of XDG_CONFIG_DIRS are ignored
+	} {
+		path, err := resolveConfig(test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: resolved to %s, want error", test.name, path)
+			}
+		} else if err != nil || path != test.want {
+			t.Errorf("%s: got %s, %v, want %s", test.name, path, err, test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = listConfigs(&buf); err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		name, rest, _ := strings.Cut(line, " ")
+		listed[name] = append(listed[name], strings.TrimSpace(rest))
+	}
+	for name, want := range map[string][]string{
+		"a": {
+			dir("project", "sub", ".rainbow", "a.rainbow") + " (project)",
+			dir("project", ".rainbow", "a.rainbow") + " (project, shadowed by " + dir("project", "sub", ".rainbow", "a.rainbow") + ")",
+			dir("xdg", "rainbow", "a.rainbow") + " (user, shadowed by " + dir("project", "sub", ".rainbow", "a.rainbow") + ")",
+			dir("sys1", "rainbow", "a.rainbow") + " (system, shadowed by " + dir("project", "sub", ".rainbow", "a.rainbow") + ")",
+		},
+		"gotest": {
+			dir("sys2", "rainbow", "gotest.rainbow") + " (system)",
+			builtinConfigPrefix + "gotest.rainbow (builtin, shadowed by " + dir("sys2", "rainbow", "gotest.rainbow") + ")",
+		},
+	} {
+		if strings.Join(listed[name], "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got listed\n%s\nwant\n%s", name, strings.Join(listed[name], "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestUserConfigDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Relative paths are invalid according to the XDG specification.
+	t.Setenv("XDG_CONFIG_HOME", "relative")
+	if dir, err := userConfigDir(); err != nil || dir != filepath.Join(home, ".config") {
+		t.Errorf("got %s, %v, want %s", dir, err, filepath.Join(home, ".config"))
+	}
+
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	if dir, err := userConfigDir(); err != nil || dir != xdg {
+		t.Errorf("got %s, %v, want %s", dir, err, xdg)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// lineContext outputs context lines around selected lines, like grep. Context
+// lines are dimmed to make the selected lines stand out.
+type lineContext struct {
+	before, after  int // Number of context lines before and after selected lines
+	seq            int // Sequence number of the current line
+	printed        int // Sequence number of the last output line, 0 if none
+	afterRemaining int // Context lines left to output after a selected line
+
+	// Rendered lines preceding the current line that have not been output.
+	ring     []bytes.Buffer
+	ringBeg  int
+	ringSize int
+}
+
+func newLineContext(before, after int) *lineContext {
+	return &lineContext{
+		before: before,
+		after:  after,
+		ring:   make([]bytes.Buffer, before),
+	}
+}
+
+var bytesContextSep = []byte("--")
+
+// output outputs the current line of the processor if it's selected or part of
+// the context of a selected line.
+func (ctx *lineContext) output(p *processor) error {
+	ctx.seq++
+
+	if p.line.selected {
+		first := ctx.seq - ctx.ringSize
+		if ctx.printed > 0 && first > ctx.printed+1 {
+			if err := ctx.writeSeparator(p); err != nil {
+				return err
+			}
+		}
+		for ; ctx.ringSize > 0; ctx.ringSize-- {
+			buf := &ctx.ring[ctx.ringBeg]
+			if _, err := p.w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			ctx.ringBeg = (ctx.ringBeg + 1) % len(ctx.ring)
+		}
+		ctx.printed, ctx.afterRemaining = ctx.seq, ctx.after
+		return p.writeLine(p.w, p.encoder)
+	}
+
+	if ctx.afterRemaining > 0 {
+		ctx.printed = ctx.seq
+		ctx.afterRemaining--
+		return p.writeLine(p.w, textEncoderDimmed(p.encoder))
+	}
+
+	if len(ctx.ring) > 0 {
+		if ctx.ringSize == len(ctx.ring) {
+			ctx.ringBeg = (ctx.ringBeg + 1) % len(ctx.ring)
+			ctx.ringSize--
+		}
+		buf := &ctx.ring[(ctx.ringBeg+ctx.ringSize)%len(ctx.ring)]
+		buf.Reset()
+		ctx.ringSize++
+		return p.writeLine(buf, textEncoderDimmed(p.encoder))
+	}
+	return nil
+}
+
+func (ctx *lineContext) writeSeparator(p *processor) error {
+	encoder, err := textEncoderDimmed(p.encoder)(p.w, properties{}, bytesContextSep)
+	if err == nil {
+		_, err = encoder(p.w, properties{}, bytesNewline)
+	}
+	return err
+}
+
+// textEncoderDimmed wraps an encoder, dimming all text but line endings.
+func textEncoderDimmed(encoder textEncoder) textEncoder {
+	return func(w io.Writer, props properties, text []byte) (textEncoder, error) {
+		if len(bytes.TrimLeft(text, "\r\n")) > 0 {
+			props.modifiers.set(modifierDim)
+		}
+		next, err := encoder(w, props, text)
+		return textEncoderDimmed(next), err
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+)
+
+// readCloser combines a reader with the closer of the underlying stream.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newDecompressReader detects gzip and bzip2 compressed data by its magic
+// number and decompresses it. Other data is passed through as is.
+func newDecompressReader(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+
+	var r io.Reader = br
+	switch {
+	case hasMagic(br, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case hasMagic(br, magicBzip2):
+		r = bzip2.NewReader(br)
+	}
+	return readCloser{r, rc}, nil
+}
+
+// hasMagic reports if the stream starts with magic. To not add latency when
+// reading from interactive streams, it only waits for more data as long as
+// what has been read so far matches the magic.
+func hasMagic(br *bufio.Reader, magic []byte) bool {
+	for n := 1; n <= len(magic); n++ {
+		if n > br.Buffered() {
+			if _, err := br.Peek(n); err != nil {
+				return false
+			}
+		}
+		data, _ := br.Peek(br.Buffered())
+		if len(data) > len(magic) {
+			data = data[:len(magic)]
+		}
+		if !bytes.HasPrefix(magic, data) {
+			return false
+		}
+		if len(data) == len(magic) {
+			return true
+		}
+	}
+	return false
+}
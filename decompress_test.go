@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestDecompressReader(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("compressed\n"))
+	zw.Close()
+
+	tests := []struct {
+		input, want string
+	}{
+		{compressed.String(), "compressed\n"},
+		{"plain\n", "plain\n"},
+		{"\x1f\n", "\x1f\n"},
+		{"BZ\n", "BZ\n"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		r, err := newDecompressReader(io.NopCloser(bytes.NewReader([]byte(test.input))))
+		if err != nil {
+			t.Errorf("input %q: %s", test.input, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("input %q: %s", test.input, err)
+		} else if string(got) != test.want {
+			t.Errorf("input %q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
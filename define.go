@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/johan-bolmsjo/saft"
+	"slices"
+	"strings"
+)
+
+// definition is a value of a define block. It's interpolated in strings where
+// they refer to it as ${name}.
+type definition struct {
+	defPos
+	name  string
+	value string
+}
+
+// definitions are indexed by name.
+type definitions map[string]*definition
+
+func (prog *program) parseDefine(elem saft.Elem, file string) error {
+	assoc, err := elemExpectAssoc(elem, parDefine)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range assoc.L {
+		name := p.K.V
+		if prev := prog.defs[name]; prev != nil {
+			return posErrorf(p.K.Pos(), "duplicate definition %q, first defined at %s", name, prev.location())
+		}
+		str, err := elemExpectString(p.V, name)
+		if err != nil {
+			return err
+		}
+		// Values may refer to values defined before them.
+		value, _, err := prog.expand(str)
+		if err != nil {
+			return err
+		}
+		prog.defs[name] = &definition{name: name, value: value, defPos: defPos{file, p.K.Pos()}}
+	}
+	return nil
+}
+
+// expand interpolates defined values in a string. The definitions used are
+// returned to refer to in errors about the expanded string. A "${" preceded by
+// a backslash is not interpolated.
+func (prog *program) expand(str *saft.String) (string, []*definition, error) {
+	s := str.V
+	if !strings.Contains(s, "${") {
+		return s, nil, nil
+	}
+
+	var sb strings.Builder
+	var used []*definition
+	for {
+		i := strings.Index(s, "${")
+		for i > 0 && s[i-1] == '\\' {
+			j := strings.Index(s[i+2:], "${")
+			if j < 0 {
+				i = -1
+				break
+			}
+			i += 2 + j
+		}
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), used, nil
+		}
+
+		n := strings.IndexByte(s[i:], '}')
+		if n < 0 {
+			return "", nil, posErrorf(str.Pos(), "missing '}' after \"${\"")
+		}
+		name := s[i+2 : i+n]
+		def := prog.defs[name]
+		if def == nil {
+			return "", nil, posErrorf(str.Pos(), "undefined value %q", name)
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(def.value)
+		if !slices.Contains(used, def) {
+			used = append(used, def)
+		}
+		s = s[i+n+1:]
+	}
+}
+
+// definitionsError adds where the definitions used by an expanded string are
+// defined to an error about the string.
+func definitionsError(err error, used []*definition) error {
+	if len(used) == 0 {
+		return err
+	}
+	var locs []string
+	for _, def := range used {
+		locs = append(locs, fmt.Sprintf("${%s} defined at %s", def.name, def.location()))
+	}
+	return fmt.Errorf("%s, using %s", err, strings.Join(locs, ", "))
+}
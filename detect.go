@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+)
+
+// Number of lines read to detect which config to use.
+const detectLines = 10
+
+// configDetector detects which config to use from the first lines of input.
+// The lines are kept to be processed once the config is known.
+type configDetector struct {
+	lines    []detectedLine
+	detected func(path string) // Optionally called with the path of a detected config
+}
+
+type detectedLine struct {
+	src      *inputSource
+	text     []byte
+	end      lineEnd
+	received time.Time
+}
+
+func newConfigDetector() *configDetector {
+	return &configDetector{}
+}
+
+// add keeps a line to detect the config from. It reports if enough lines have
+// been read.
+func (d *configDetector) add(src *inputSource, text []byte, end lineEnd, received time.Time) bool {
+	d.lines = append(d.lines, detectedLine{src: src, text: text, end: end, received: received})
+	return len(d.lines) >= detectLines
+}
+
+// detect returns the program of the config in the config search path whose
+// detect regexp matches the most lines, and the path of its config. The first
+// config by name is chosen if several match equally many lines. Configs that
+// fail to load are skipped. A program that outputs lines as is is returned if
+// no config matches any line.
+func (d *configDetector) detect() (*program, string) {
+	best, bestPath, bestScore := newProgram("<none>"), "", 0
+
+	var prev *configEntry
+	for _, c := range findConfigs() {
+		shadowed := prev != nil && prev.name == c.name
+		prev = c
+		if shadowed {
+			continue
+		}
+
+		prog, err := loadProgram(c.path)
+		if err != nil || prog.detect == nil {
+			continue
+		}
+		score := 0
+		for _, l := range d.lines {
+			if prog.detect.Match(l.text) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestPath, bestScore = prog, c.path, score
+		}
+	}
+	return best, bestPath
+}
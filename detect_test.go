@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestDetectProgram(t *testing.T) {
+	// Only detect built-in configs.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"2026-10-17 21:34:00.123 [ERROR] Fred: lost drone\n", builtinConfigPrefix + "applog.rainbow"},
+		{"diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n", builtinConfigPrefix + "diff.rainbow"},
+		{"=== RUN   TestX\n--- FAIL: TestX (0.00s)\nFAIL\n", builtinConfigPrefix + "gotest.rainbow"},
+		{"plain\ntext\n", "<none>"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		proc := newProcessor(newProgram("<none>"), bufio.NewWriter(&buf), textEncoderDummy)
+		proc.detector = newConfigDetector()
+		if err := proc.processSource(newStringSource("test", test.input)); err != nil {
+			t.Fatal(err)
+		}
+		if err := proc.detectProgram(); err != nil {
+			t.Fatal(err)
+		}
+		if proc.prog.name != test.want {
+			t.Errorf("input %q: detected %s, want %s", test.input, proc.prog.name, test.want)
+		}
+		if buf.String() != test.input {
+			t.Errorf("input %q: got output %q", test.input, buf.String())
+		}
+	}
+}
@@ -10,6 +10,26 @@ func posErrorf(pos saft.LexPos, format string, a ...interface{}) error {
 	return fmt.Errorf(pos.String()+": "+format, a...)
 }
 
+// location formats a position in a file. The file is left out if empty, the
+// position is then in the config file being loaded.
+func location(file string, pos saft.LexPos) string {
+	if file == "" {
+		return pos.String()
+	}
+	return file + ":" + pos.String()
+}
+
+// defPos is where something is defined in the config.
+type defPos struct {
+	file string // Included config file, empty if not included
+	pos  saft.LexPos
+}
+
+// location returns where it's defined.
+func (d defPos) location() string {
+	return location(d.file, d.pos)
+}
+
 func posWrapError(err error, pos saft.LexPos) error {
 	return errors.Wrap(err, pos.String())
 }
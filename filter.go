@@ -8,10 +8,12 @@ import (
 )
 
 type filter struct {
+	defPos
 	name       string
 	regexp     *regexp.Regexp
 	regexpFrom *filter
-	props      map[int]properties // Properites indexed by regexp group
+	props      map[int]properties  // Properites indexed by regexp group, or groupElse
+	groupPos   map[int]saft.LexPos // Position of properties indexed by regexp group, or groupElse
 	filters    filterList
 	state      *filterState
 }
@@ -33,7 +35,11 @@ func (props *properties) mergeWith(other properties) {
 
 const filterSep = "/"
 
-func elemParseFilter(elem saft.Elem, prog *program) (*filter, error) {
+// groupElse indexes the properties of the parts of a regexp match not covered
+// by any matched group.
+const groupElse = -1
+
+func elemParseFilter(elem saft.Elem, prog *program, file string) (*filter, error) {
 	assoc, err := elem.ExpectAssoc()
 	if err != nil {
 		return nil, err
@@ -45,8 +51,13 @@ func elemParseFilter(elem saft.Elem, prog *program) (*filter, error) {
 		return nil, err
 	}
 
-	filter := filter{props: map[int]properties{}}
+	filter := filter{
+		defPos:   defPos{file, elem.Pos()},
+		props:    map[int]properties{},
+		groupPos: map[int]saft.LexPos{},
+	}
 	var str *saft.String
+	var named []namedProperties
 
 	for _, p := range assoc.L {
 		key := p.K.V
@@ -64,8 +75,12 @@ func elemParseFilter(elem saft.Elem, prog *program) (*filter, error) {
 			if str, err = elemExpectString(p.V, key); err != nil {
 				return nil, err
 			}
-			if filter.regexp, err = regexp.Compile(str.V); err != nil {
-				return nil, posWrapError(err, str.Pos())
+			value, used, err := prog.expand(str)
+			if err != nil {
+				return nil, err
+			}
+			if filter.regexp, err = regexp.Compile(value); err != nil {
+				return nil, posWrapError(definitionsError(err, used), str.Pos())
 			}
 
 		case parFilterRegexpFrom:
@@ -80,17 +95,17 @@ func elemParseFilter(elem saft.Elem, prog *program) (*filter, error) {
 			}
 
 		case parFilterProperties:
-			if err = elemParseFilterProperties(p.V, key, &filter); err != nil {
+			if named, err = elemParseFilterProperties(p.V, key, &filter, prog, named); err != nil {
 				return nil, err
 			}
 
 		case parFilter:
-			nestedFilter, err := elemParseFilter(p.V, prog)
+			nestedFilter, err := elemParseFilter(p.V, prog, file)
 			if err != nil {
 				return nil, err
 			}
-			if filter.filters.find(nestedFilter.name) != nil {
-				return nil, posErrorf(p.V.Pos(), "duplicate filter %q", nestedFilter.name)
+			if prev := filter.filters.find(nestedFilter.name); prev != nil {
+				return nil, posErrorf(p.V.Pos(), "duplicate filter %q, first defined at %s", nestedFilter.name, prev.location())
 			}
 			filter.filters = append(filter.filters, nestedFilter)
 
@@ -99,84 +114,193 @@ func elemParseFilter(elem saft.Elem, prog *program) (*filter, error) {
 		}
 	}
 
+	if err = filter.resolveGroupNames(named); err != nil {
+		return nil, err
+	}
+
 	filter.state = prog.globalFilterState.allocState()
 	return &filter, nil
 }
 
-func elemParseFilterProperties(elem saft.Elem, param string, filter *filter) error {
+// matchRegexp returns the regexp the filter matches lines with, nil if none.
+func (f *filter) matchRegexp() *regexp.Regexp {
+	if f.regexpFrom != nil {
+		return f.regexpFrom.regexp
+	}
+	return f.regexp
+}
+
+// findGroup finds a regexp group of the filter by name or number.
+func (f *filter) findGroup(name string) (int, bool) {
+	re := f.matchRegexp()
+	if re == nil {
+		return 0, false
+	}
+	if group, err := strconv.Atoi(name); err == nil {
+		return group, group >= 0 && group <= re.NumSubexp()
+	}
+	group := re.SubexpIndex(name)
+	return group, group >= 0
+}
+
+// namedProperties are properties of a named regexp group. They are resolved to
+// the group number once the regexp of the filter is known.
+type namedProperties struct {
+	name  string
+	pos   saft.LexPos
+	props properties
+}
+
+// elemParseFilterProperties parses properties of regexp groups. Properties of
+// groups given by name are appended to named.
+func elemParseFilterProperties(elem saft.Elem, param string, filter *filter, prog *program, named []namedProperties) ([]namedProperties, error) {
 	assoc, err := elemExpectAssoc(elem, param)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, p := range assoc.L {
-		var group int
-		if group, err = strconv.Atoi(p.K.V); err != nil || group <= 0 {
-			return posErrorf(p.K.Pos(), "invalid regexp group %q", p.K.V)
+		group, err := strconv.Atoi(p.K.V)
+		isName := err != nil
+		if p.K.V == parFilterPropertiesElse {
+			group, isName = groupElse, false
+		} else if !isName && group < 0 {
+			return nil, posErrorf(p.K.Pos(), "invalid regexp group %q", p.K.V)
 		}
 
 		var props properties
-		if props, err = elemParseProperties(p.V); err != nil {
-			return err
+		if props, err = elemParseProperties(p.V, prog); err != nil {
+			return nil, err
+		}
+		if isName {
+			named = append(named, namedProperties{name: p.K.V, pos: p.K.Pos(), props: props})
+			continue
 		}
 		filter.props[group] = props
+		filter.groupPos[group] = p.K.Pos()
+	}
+	return named, nil
+}
+
+// resolveGroupNames sets properties of named regexp groups by group number.
+func (f *filter) resolveGroupNames(named []namedProperties) error {
+	re := f.matchRegexp()
+	for _, n := range named {
+		if re == nil {
+			return posErrorf(n.pos, "regexp group %q does not exist, the filter has no regexp", n.name)
+		}
+		group := re.SubexpIndex(n.name)
+		if group < 0 {
+			return posErrorf(n.pos, "regexp group %q does not exist", n.name)
+		}
+		if pos, ok := f.groupPos[group]; ok {
+			return posErrorf(n.pos, "duplicate properties of regexp group %d, first given at %s", group, location(f.file, pos))
+		}
+		f.props[group] = n.props
+		f.groupPos[group] = n.pos
 	}
 	return nil
 }
 
-func elemParseProperties(elem saft.Elem) (properties, error) {
+func elemParseProperties(elem saft.Elem, prog *program) (properties, error) {
 	assoc, err := elem.ExpectAssoc()
 	if err != nil {
 		return properties{}, err
 	}
-	if err = assocCheckDuplicates(assoc, parPropertyColor, parPropertyBGColor, parPropertyModifiers); err != nil {
+	return assocParseProperties(assoc, prog, nil)
+}
+
+// assocParseProperties parses properties, optionally based on a style. Set
+// properties replace those of the style. The properties are named if name is
+// not nil, as when defining a style.
+func assocParseProperties(assoc *saft.Assoc, prog *program, name **saft.String) (properties, error) {
+	err := assocCheckDuplicates(assoc, parStyleName, parStyle, parPropertyColor, parPropertyBGColor, parPropertyModifiers)
+	if err != nil {
 		return properties{}, err
 	}
 
 	var props properties
+	var base *style
+	var setColor, setBGColor, setModifiers bool
 
 	for _, p := range assoc.L {
 		key := p.K.V
 		switch key {
+		case parStyleName:
+			if name == nil {
+				return properties{}, unknownParameterError(&p)
+			}
+			if *name, err = elemExpectString(p.V, key); err != nil {
+				return properties{}, err
+			}
+
+		case parStyle:
+			str, err := elemExpectString(p.V, key)
+			if err != nil {
+				return properties{}, err
+			}
+			if base, err = prog.findStyle(str); err != nil {
+				return properties{}, err
+			}
+
 		case parPropertyColor:
-			if props.fgcolor, err = elemParseColor(p.V, key); err != nil {
+			if props.fgcolor, err = elemParseColor(p.V, key, prog); err != nil {
 				return properties{}, err
 			}
+			setColor = true
 
 		case parPropertyBGColor:
-			if props.bgcolor, err = elemParseColor(p.V, key); err != nil {
+			if props.bgcolor, err = elemParseColor(p.V, key, prog); err != nil {
 				return properties{}, err
 			}
+			setBGColor = true
 
 		case parPropertyModifiers:
 			var modifiers []modifier
-			if modifiers, err = elemParseModifierList(p.V, key); err != nil {
+			if modifiers, err = elemParseModifierList(p.V, key, prog); err != nil {
 				return properties{}, err
 			}
 			for _, modifier := range modifiers {
 				props.modifiers.set(modifier)
 			}
+			setModifiers = true
 
 		default:
 			return properties{}, unknownParameterError(&p)
 		}
 	}
+
+	if base != nil {
+		if !setColor {
+			props.fgcolor = base.props.fgcolor
+		}
+		if !setBGColor {
+			props.bgcolor = base.props.bgcolor
+		}
+		if !setModifiers {
+			props.modifiers = base.props.modifiers
+		}
+	}
 	return props, nil
 }
 
-func elemParseColor(elem saft.Elem, param string) (color, error) {
+func elemParseColor(elem saft.Elem, param string, prog *program) (color, error) {
 	str, err := elemExpectString(elem, param)
 	if err != nil {
 		return colorNone, err
 	}
-	color, err := parseColor(str.V)
+	value, used, err := prog.expand(str)
+	if err != nil {
+		return colorNone, err
+	}
+	color, err := parseColor(value)
 	if err != nil {
-		return colorNone, posWrapError(err, str.Pos())
+		return colorNone, posWrapError(definitionsError(err, used), str.Pos())
 	}
 	return color, nil
 }
 
-func elemParseModifierList(elem saft.Elem, param string) ([]modifier, error) {
+func elemParseModifierList(elem saft.Elem, param string, prog *program) ([]modifier, error) {
 	strList, err := elemExpectListOfString(elem, param)
 	if err != nil {
 		return nil, err
@@ -184,9 +308,13 @@ func elemParseModifierList(elem saft.Elem, param string) ([]modifier, error) {
 
 	var modifiers []modifier
 	for _, str := range strList {
-		modifier, err := parseModifier(str.V)
+		value, used, err := prog.expand(str)
+		if err != nil {
+			return nil, err
+		}
+		modifier, err := parseModifier(value)
 		if err != nil {
-			return nil, posWrapError(err, str.Pos())
+			return nil, posWrapError(definitionsError(err, used), str.Pos())
 		}
 		modifiers = append(modifiers, modifier)
 	}
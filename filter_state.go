@@ -16,6 +16,14 @@ func (gfs *globalFilterState) clear() {
 	}
 }
 
+// discard discards the match results of the current line without saving them
+// in the match history.
+func (gfs *globalFilterState) discard() {
+	for _, v := range gfs.l {
+		v.discard()
+	}
+}
+
 func (gfs *globalFilterState) allocState() *filterState {
 	fs := new(filterState)
 	gfs.l = append(gfs.l, fs)
@@ -23,7 +31,9 @@ func (gfs *globalFilterState) allocState() *filterState {
 }
 
 type filterState struct {
-	matched bool // Regexp matched current line
+	matched      bool // Regexp matched current line
+	matchedFrom  bool // Regexp of referenced filter matched current line, for statistics
+	matchedLines int  // Number of matched lines, for statistics
 
 	// Current and previously matched line.
 	hist [2]struct {
@@ -56,7 +66,15 @@ func (fs *filterState) clear() {
 	if fs.matched {
 		fs.hist[1] = fs.hist[0]
 	}
+	if fs.matched || fs.matchedFrom {
+		fs.matchedLines++
+	}
+	fs.discard()
+}
+
+func (fs *filterState) discard() {
 	fs.matched = false
+	fs.matchedFrom = false
 	fs.hist[0].line = nil
 	fs.hist[0].res = nil
 }
@@ -85,3 +103,27 @@ func (fs *filterState) valueMatchResultN(n int) igor.ObjectString {
 
 	return igor.ObjectString(sb.String())
 }
+
+// valueMatchResultGroup returns a regexp group of the current or previously
+// matched regexp result. The group of each match is separated by a zero byte
+// marker.
+func (fs *filterState) valueMatchResultGroup(n, group int) igor.ObjectString {
+	if n < 0 || n >= len(fs.hist) {
+		return igor.ObjectString("")
+	}
+	hist := &fs.hist[n]
+
+	const matchSepMarker = 0
+
+	var sb strings.Builder
+	for i, a := range hist.res {
+		if i > 0 {
+			sb.WriteByte(matchSepMarker)
+		}
+		if beg, end := a[2*group], a[2*group+1]; beg != -1 {
+			sb.Write(hist.line[beg:end])
+		}
+	}
+
+	return igor.ObjectString(sb.String())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Interval between checks for new data when following a file.
+const followPollInterval = 250 * time.Millisecond
+
+// followReader reads a file like "tail -F". Reads block waiting for data to be
+// appended to the file. Truncation of the file restarts reading from the
+// beginning and a rotated file (the path now refers to another inode) is
+// reopened once all data of the old file has been read.
+type followReader struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+func newFollowReader(path string) (*followReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &followReader{path: path, file: file, info: info}, nil
+}
+
+func (fr *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := fr.file.Read(p)
+		fr.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if err = fr.checkRotation(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// checkRotation is called when all data available in the file has been read.
+// It waits for new data to arrive either by the file growing, being truncated or
+// being replaced.
+func (fr *followReader) checkRotation() error {
+	for {
+		info, err := os.Stat(fr.path)
+		if err != nil {
+			// The path may be missing for a short while during rotation.
+			// Keep the old file open until a new one appears.
+			time.Sleep(followPollInterval)
+			continue
+		}
+
+		if !os.SameFile(fr.info, info) {
+			// Drain data written to the old file before it was rotated.
+			if old, err := fr.file.Stat(); err == nil && old.Size() > fr.offset {
+				return nil
+			}
+			file, err := os.Open(fr.path)
+			if err != nil {
+				time.Sleep(followPollInterval)
+				continue
+			}
+			fr.file.Close()
+			fr.file, fr.info, fr.offset = file, info, 0
+			return nil
+		}
+
+		if info.Size() < fr.offset {
+			if _, err = fr.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			fr.offset = 0
+			return nil
+		}
+
+		if info.Size() > fr.offset {
+			return nil
+		}
+		time.Sleep(followPollInterval)
+	}
+}
+
+func (fr *followReader) Close() error {
+	return fr.file.Close()
+}
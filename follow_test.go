@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	writeFile := func(path, data string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(path, "first\n", os.O_TRUNC)
+
+	fr, err := newFollowReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	// Data must be available before each read as reads block waiting for it.
+	expectRead := func(what, want string) {
+		t.Helper()
+		buf := make([]byte, 64)
+		n, err := fr.Read(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Fatalf("%s: got %q, want %q", what, got, want)
+		}
+	}
+	expectRead("initial", "first\n")
+
+	writeFile(path, "appended\n", os.O_APPEND)
+	expectRead("appended", "appended\n")
+
+	writeFile(path, "trunc\n", os.O_TRUNC)
+	expectRead("truncated", "trunc\n")
+
+	// Data written to the rotated file is read before the new file.
+	rotated := path + ".1"
+	if err = os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(rotated, "late\n", os.O_APPEND)
+	writeFile(path, "new\n", os.O_TRUNC)
+	expectRead("rotated", "late\n")
+	expectRead("reopened", "new\n")
+}
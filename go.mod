@@ -8,9 +8,7 @@ require (
 	github.com/johan-bolmsjo/saft v1.0.2
 	github.com/mattn/go-colorable v0.1.1
 	github.com/mattn/go-isatty v0.0.6
+	golang.org/x/sys v0.37.0
 )
 
-require (
-	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
-	golang.org/x/sys v0.37.0 // indirect
-)
+require golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
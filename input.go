@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// inputSource is a named source of input lines.
+type inputSource struct {
+	name   string
+	prefix []byte     // Name as output in line prefixes
+	props  properties // Properties of the line prefix
+	open   func() (io.ReadCloser, error)
+}
+
+func newInputSource(name string, open func() (io.ReadCloser, error)) *inputSource {
+	return &inputSource{
+		name:   name,
+		prefix: []byte(name),
+		props:  properties{fgcolor: sourceColor(name)},
+		open:   open,
+	}
+}
+
+func newStdinSource() *inputSource {
+	return newInputSource("stdin", func() (io.ReadCloser, error) {
+		r, err := newDecompressReader(io.NopCloser(os.Stdin))
+		if err != nil {
+			return nil, fmt.Errorf("stdin: %s", err)
+		}
+		return r, nil
+	})
+}
+
+func newFileSource(path string) *inputSource {
+	return newInputSource(path, func() (io.ReadCloser, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := newDecompressReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return r, nil
+	})
+}
+
+func newFollowSource(path string) *inputSource {
+	return newInputSource(path, func() (io.ReadCloser, error) {
+		return newFollowReader(path)
+	})
+}
+
+// Colors used for source name prefixes. Black and white are avoided as they
+// are likely to be the terminal background color.
+var sourceColors = []color{
+	colorGreen, colorYellow, colorBlue, colorMagenta, colorCyan,
+	colorIGreen, colorIYellow, colorIBlue, colorIMagenta, colorICyan,
+}
+
+// sourceColor picks a color for a source name. The same name always gets the
+// same color.
+func sourceColor(name string) color {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return sourceColors[h.Sum32()%uint32(len(sourceColors))]
+}
@@ -104,3 +104,11 @@ func WriteCodes(w io.Writer, codes ...Code) error {
 	write(escapeSeqEnd)
 	return es.Cause()
 }
+
+var eraseLine = []byte("\r" + escapeSeq + "2K")
+
+// WriteEraseLine moves the cursor to the start of the line and erases it.
+func WriteEraseLine(w io.Writer) error {
+	_, err := w.Write(eraseLine)
+	return err
+}
@@ -1,5 +1,9 @@
 package igor
 
+import (
+	"github.com/johan-bolmsjo/saft"
+)
+
 // Cond is a condition that evaluates to a boolean value.
 type Cond struct {
 	call *objectCall
@@ -17,3 +21,18 @@ func (cond *Cond) Eval() (bool, error) {
 	}
 	return bool(objectIsTrue(res)), nil
 }
+
+// Call describes a function call of a compiled condition.
+type Call struct {
+	Pos  saft.LexPos
+	Name string
+	Args []Object // Nested calls are of type TypeCall
+}
+
+// Walk calls f for each function call of the condition, outer calls before the
+// calls of their arguments.
+func (cond *Cond) Walk(f func(call Call)) {
+	if cond != nil {
+		cond.call.walk(f)
+	}
+}
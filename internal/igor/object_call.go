@@ -38,3 +38,12 @@ func (call *objectCall) evalTop() (obj Object, err error) {
 	obj = call.eval()
 	return
 }
+
+func (call *objectCall) walk(f func(call Call)) {
+	f(Call{Pos: call.pos, Name: call.name, Args: call.args})
+	for _, arg := range call.args {
+		if arg, ok := arg.(*objectCall); ok {
+			arg.walk(f)
+		}
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"github.com/johan-bolmsjo/gods/v4/list"
 	"github.com/johan-bolmsjo/gods/v4/math"
 	"io"
+	"time"
 )
 
 type line struct {
+	src          *inputSource
 	text         []byte // shared data, must not be modified after initialization
+	end          lineEnd
+	invalid      []interval // Text replacing invalid input
+	number       int        // Number of the line in its source, starting at 1
+	received     time.Time  // Time the line was read
+	selected     bool       // Line is to be output
 	segmentIndex *avltree.Tree[int, *lineSegment]
 	segmentList  lineSegment
 }
@@ -52,8 +59,11 @@ func newLine() *line {
 	return l
 }
 
-func (l *line) init(text []byte) {
+func (l *line) init(src *inputSource, text []byte, end lineEnd) {
+	l.src = src
 	l.text = text
+	l.end = end
+	l.invalid = nil
 	for _, s := range l.segmentIndex.All() {
 		releaseLineSegment(s)
 	}
@@ -71,6 +81,7 @@ func (l *line) init(text []byte) {
 }
 
 func (l *line) applyProgram(prog *program) error {
+	prog.line = l
 	for _, stm := range prog.stms {
 		doApply, err := stm.cond.Eval()
 		if err != nil {
@@ -78,33 +89,93 @@ func (l *line) applyProgram(prog *program) error {
 		} else if !doApply {
 			continue
 		}
+		if l.end != lineEndPartial {
+			stm.appliedLines++
+		}
 		stm.filters.apply(l.applyFilter)
 	}
 
-	prog.globalFilterState.clear()
+	// Replaced invalid input is shown the same way as markers.
+	for _, ival := range l.invalid {
+		l.spliceProperties(ival, markerProps)
+	}
+
+	var err error
+	if l.selected, err = prog.selection.selects(l); err != nil {
+		return decorateErrorWithSource(err, prog.name)
+	}
+
+	// A partial line is processed again when complete. It must not affect the
+	// match history.
+	if l.end == lineEndPartial {
+		prog.globalFilterState.discard()
+	} else {
+		prog.globalFilterState.clear()
+	}
 	return nil
 }
 
+// matchFilter reports if the filter, or any of its nested filters, matches the
+// line. The filter does not need to have been applied.
+func (l *line) matchFilter(f *filter) bool {
+	if f.regexp != nil {
+		if f.state.match(l.text, f.regexp, false) != nil {
+			return true
+		}
+	} else if f.regexpFrom != nil {
+		if f.regexpFrom.state.match(l.text, f.regexpFrom.regexp, false) != nil {
+			return true
+		}
+	}
+	for _, nested := range f.filters {
+		if l.matchFilter(nested) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *line) applyFilter(f *filter) {
 	var r [][]int
 	if f.regexp != nil {
 		r = f.state.match(l.text, f.regexp, true)
 	} else if f.regexpFrom != nil {
-		r = f.regexpFrom.state.match(l.text, f.regexpFrom.regexp, false)
+		// The match result is owned by the referenced filter. The match is
+		// only recorded to count the lines matched by this filter.
+		if r = f.regexpFrom.state.match(l.text, f.regexpFrom.regexp, false); r != nil {
+			f.state.matchedFrom = true
+		}
 	}
 
-	applyToRegexpResult(r, func(group int, ival interval) {
-		if ival.beg != -1 {
-			if props, ok := f.props[group]; ok {
-				l.spliceProperties(ival, props)
-			}
-		}
-	})
+	for _, match := range r {
+		l.applyMatchProperties(f, match)
+	}
 
 	// Apply sub filters
 	f.filters.apply(l.applyFilter)
 }
 
+// applyMatchProperties applies the properties of a filter to a regexp match.
+// The properties of the whole match and of the parts no group covers are
+// applied first for the properties of groups to be merged with them.
+func (l *line) applyMatchProperties(f *filter, match []int) {
+	if props, ok := f.props[0]; ok && match[0] < match[1] {
+		l.spliceProperties(interval{match[0], match[1]}, props)
+	}
+	if props, ok := f.props[groupElse]; ok {
+		for _, ival := range uncoveredIntervals(match) {
+			l.spliceProperties(ival, props)
+		}
+	}
+	for i := 2; i < len(match); i += 2 {
+		if match[i] != -1 {
+			if props, ok := f.props[i/2]; ok {
+				l.spliceProperties(interval{match[i], match[i+1]}, props)
+			}
+		}
+	}
+}
+
 func (l *line) insertSegment(newSegment, prevSegment *lineSegment) {
 	l.segmentIndex.Add(newSegment.Value.ival.beg, newSegment)
 	prevSegment.LinkNext(newSegment)
@@ -160,7 +231,18 @@ func (l *line) spliceProperties(ival interval, props properties) {
 
 // The compiler does not seem smart enough to avoid memory allocations when directly
 // passing []byte("...") to a function accepting a byte slice.
-var bytesNewline = []byte("\n")
+var (
+	bytesNewline = []byte("\n")
+	bytesCRLF    = []byte("\r\n")
+	bytesCR      = []byte("\r")
+)
+
+// Markers output at the end of lines that were too long.
+var (
+	bytesSplitMarker     = []byte("↵")
+	bytesTruncatedMarker = []byte("…")
+	markerProps          = properties{modifiers: modifierSet(1 << modifierReverse)}
+)
 
 func (l *line) output(w io.Writer, encoder textEncoder) error {
 	var err error
@@ -170,7 +252,37 @@ func (l *line) output(w io.Writer, encoder textEncoder) error {
 			return err
 		}
 	}
-	if _, err = encoder(w, properties{}, bytesNewline); err != nil {
+	return l.outputEnd(w, encoder)
+}
+
+// outputEnd outputs the end of line, including any marker. The original line
+// ending is retained. Lines without one end with a newline.
+func (l *line) outputEnd(w io.Writer, encoder textEncoder) error {
+	var err error
+	ending := bytesNewline
+
+	switch l.end {
+	case lineEndPartial:
+		return nil
+	case lineEndCRLF:
+		ending = bytesCRLF
+	case lineEndCR:
+		ending = bytesCR
+	case lineEndSplit:
+		encoder, err = encoder(w, markerProps, bytesSplitMarker)
+	case lineEndTruncated:
+		encoder, err = encoder(w, markerProps, bytesTruncatedMarker)
+	case lineEndTruncatedCRLF:
+		encoder, err = encoder(w, markerProps, bytesTruncatedMarker)
+		ending = bytesCRLF
+	case lineEndTruncatedCR:
+		encoder, err = encoder(w, markerProps, bytesTruncatedMarker)
+		ending = bytesCR
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = encoder(w, properties{}, ending); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// lineEnd describes how a line read by lineReader ended.
+type lineEnd uint8
+
+const (
+	lineEndNewline       lineEnd = iota // Line ended with a newline
+	lineEndCRLF                         // Line ended with a carriage return and a newline
+	lineEndCR                           // Line ended with a bare carriage return
+	lineEndEOF                          // Last line of input without a newline
+	lineEndSplit                        // Line too long, the rest follows as the next line
+	lineEndTruncated                    // Line too long, the rest was discarded
+	lineEndTruncatedCRLF                // Truncated line that ended with a carriage return and a newline
+	lineEndTruncatedCR                  // Truncated line that ended with a bare carriage return
+	lineEndPartial                      // Incomplete line, output while waiting for the rest
+)
+
+// bareCR reports if the line ended with a bare carriage return.
+func (end lineEnd) bareCR() bool {
+	return end == lineEndCR || end == lineEndTruncatedCR
+}
+
+const lineReaderMinBufSize = 4096
+
+// lineReader reads lines of unlimited length. Lines longer than an optional
+// maximum length are split or truncated. Lines end with a newline, optionally
+// preceded by a carriage return which is not part of the line. Bare carriage
+// returns optionally end lines as well.
+type lineReader struct {
+	r        io.Reader
+	maxLen   int                  // Maximum line length in bytes, 0 for unlimited
+	truncate bool                 // Truncate rather than split lines longer than maxLen
+	splitCR  bool                 // Bare carriage returns end lines
+	waiting  func(pending []byte) // Optionally called with an incomplete line before reading more of it
+	buf      []byte
+	beg, end int   // Unread data in buf
+	err      error // Error of last read, reported once all data is consumed
+}
+
+func newLineReader(r io.Reader, maxLen int, truncate bool) *lineReader {
+	return &lineReader{
+		r:        r,
+		maxLen:   maxLen,
+		truncate: truncate,
+		buf:      make([]byte, lineReaderMinBufSize),
+	}
+}
+
+// readLine returns the next line without its line ending. The returned slice
+// is uniquely allocated for each line. io.EOF is returned at the end of input.
+func (lr *lineReader) readLine() ([]byte, lineEnd, error) {
+	scanned := 0
+	for {
+		data := lr.buf[lr.beg:lr.end]
+		if i := lr.indexLineEnd(data[scanned:]); i >= 0 {
+			n := scanned + i
+			// A carriage return before the newline is not part of the line.
+			length := n
+			if data[n] == '\n' && n > 0 && data[n-1] == '\r' {
+				length--
+			}
+			if lr.maxLen == 0 || length <= lr.maxLen {
+				if text, end, ok := lr.endLine(data, n); ok {
+					return text, end, nil
+				}
+				// A carriage return last in the buffer may be followed by a
+				// newline not yet read.
+				scanned = n
+				lr.fill()
+				continue
+			}
+		}
+		scanned = lr.end - lr.beg
+
+		// A carriage return last may be followed by a newline not yet read.
+		length := scanned
+		if length > 0 && data[length-1] == '\r' && lr.err == nil {
+			length--
+		}
+		if lr.maxLen > 0 && length > lr.maxLen {
+			n := lr.splitPoint()
+			if lr.truncate {
+				text := lr.consume(n, n)
+				return text, lr.discardLine(), nil
+			}
+			return lr.consume(n, n), lineEndSplit, nil
+		}
+
+		if lr.err != nil {
+			if scanned > 0 {
+				return lr.consume(scanned, scanned), lineEndEOF, nil
+			}
+			return nil, lineEndEOF, lr.err
+		}
+		lr.fill()
+	}
+}
+
+// indexLineEnd returns the index of the first character that may end a line,
+// -1 if there is none.
+func (lr *lineReader) indexLineEnd(data []byte) int {
+	if lr.splitCR {
+		return bytes.IndexAny(data, "\r\n")
+	}
+	return bytes.IndexByte(data, '\n')
+}
+
+// endLine consumes the line of unread data ending at index n. It fails if more
+// data must be read to tell a bare carriage return from one followed by a
+// newline.
+func (lr *lineReader) endLine(data []byte, n int) ([]byte, lineEnd, bool) {
+	switch {
+	case data[n] == '\n' && n > 0 && data[n-1] == '\r':
+		return lr.consume(n-1, n+1), lineEndCRLF, true
+	case data[n] == '\n':
+		return lr.consume(n, n+1), lineEndNewline, true
+	case n+1 < len(data) && data[n+1] == '\n':
+		return lr.consume(n, n+2), lineEndCRLF, true
+	case n+1 < len(data) || lr.err != nil:
+		return lr.consume(n, n+1), lineEndCR, true
+	}
+	return nil, lineEndCR, false
+}
+
+// splitPoint finds where to split a too long line. Lines are split on UTF-8
+// character boundaries if possible.
+func (lr *lineReader) splitPoint() int {
+	n := lr.maxLen
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(lr.buf[lr.beg+i]) {
+			return i
+		}
+	}
+	return n
+}
+
+// consume returns a copy of the n first bytes of unread data and skips skip
+// bytes.
+func (lr *lineReader) consume(n, skip int) []byte {
+	text := append([]byte(nil), lr.buf[lr.beg:lr.beg+n]...)
+	lr.beg += skip
+	return text
+}
+
+// discardLine skips data until and including the next line ending and returns
+// how the truncated line ended. Read errors are reported by the next call to
+// readLine.
+func (lr *lineReader) discardLine() lineEnd {
+	prevCR := false // Last byte discarded before the unread data is a carriage return
+	for {
+		data := lr.buf[lr.beg:lr.end]
+		if i := lr.indexLineEnd(data); i >= 0 {
+			switch {
+			case data[i] == '\n' && (i > 0 && data[i-1] == '\r' || i == 0 && prevCR):
+				lr.beg += i + 1
+				return lineEndTruncatedCRLF
+			case data[i] == '\n':
+				lr.beg += i + 1
+				return lineEndTruncated
+			case i+1 < len(data) && data[i+1] == '\n':
+				lr.beg += i + 2
+				return lineEndTruncatedCRLF
+			case i+1 < len(data) || lr.err != nil:
+				lr.beg += i + 1
+				return lineEndTruncatedCR
+			}
+			// Keep the carriage return until it's known if a newline follows.
+			lr.beg += i
+		} else {
+			if len(data) > 0 {
+				prevCR = data[len(data)-1] == '\r'
+			}
+			lr.beg = lr.end
+			if lr.err != nil {
+				return lineEndTruncated
+			}
+		}
+		lr.fill()
+	}
+}
+
+// fill reads more data into the buffer, growing it if full.
+func (lr *lineReader) fill() {
+	if lr.beg > 0 {
+		lr.end = copy(lr.buf, lr.buf[lr.beg:lr.end])
+		lr.beg = 0
+	}
+	if lr.end == len(lr.buf) {
+		buf := make([]byte, 2*len(lr.buf))
+		copy(buf, lr.buf[:lr.end])
+		lr.buf = buf
+	}
+
+	if lr.waiting != nil {
+		if pending := lr.pending(); pending != nil {
+			lr.waiting(pending)
+		}
+	}
+
+	n, err := lr.r.Read(lr.buf[lr.end:])
+	lr.end += n
+	lr.err = err
+}
+
+// pending returns a copy of the incomplete line buffered by the reader, nil if
+// there is none.
+func (lr *lineReader) pending() []byte {
+	// A trailing carriage return may be followed by a newline not yet read.
+	data := bytes.TrimSuffix(lr.buf[lr.beg:lr.end], bytesCR)
+	if len(data) == 0 || lr.indexLineEnd(data) >= 0 {
+		// A complete line is about to be returned by readLine.
+		return nil
+	}
+	if lr.maxLen > 0 && len(data) > lr.maxLen {
+		return nil
+	}
+	return append([]byte(nil), data...)
+}
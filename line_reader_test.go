@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineReader(t *testing.T) {
+	type result struct {
+		text string
+		end  lineEnd
+	}
+	long := strings.Repeat("x", 3*lineReaderMinBufSize)
+
+	tests := []struct {
+		input    string
+		maxLen   int
+		truncate bool
+		want     []result
+	}{
+		{"a\nbc\n", 0, false, []result{{"a", lineEndNewline}, {"bc", lineEndNewline}}},
+		{"a\nbc", 0, false, []result{{"a", lineEndNewline}, {"bc", lineEndEOF}}},
+		{"\n\n", 0, false, []result{{"", lineEndNewline}, {"", lineEndNewline}}},
+		{long + "\nz\n", 0, false, []result{{long, lineEndNewline}, {"z", lineEndNewline}}},
+		{"abcdefg\nh\n", 3, false, []result{
+			{"abc", lineEndSplit}, {"def", lineEndSplit}, {"g", lineEndNewline}, {"h", lineEndNewline}}},
+		{"abc\n", 3, false, []result{{"abc", lineEndNewline}}},
+		{"abc\r\nxyz\n", 3, false, []result{{"abc", lineEndCRLF}, {"xyz", lineEndNewline}}},
+		{"abc\r\nxyz\n", 3, true, []result{{"abc", lineEndCRLF}, {"xyz", lineEndNewline}}},
+		{"abcd\r\nxyz\n", 3, false, []result{{"abc", lineEndSplit}, {"d", lineEndCRLF}, {"xyz", lineEndNewline}}},
+		{"abcdefg\nh\n", 3, true, []result{{"abc", lineEndTruncated}, {"h", lineEndNewline}}},
+		{"abcdefg", 3, true, []result{{"abc", lineEndTruncated}}},
+		{"abcdefg\r\nh\r\n", 3, true, []result{{"abc", lineEndTruncatedCRLF}, {"h", lineEndCRLF}}},
+		{"abcd\re\nf\n", 3, true, []result{{"abc", lineEndTruncated}, {"f", lineEndNewline}}},
+		{"aåäö\n", 4, false, []result{{"aå", lineEndSplit}, {"äö", lineEndNewline}}},
+		{"a\r\nb\rc\r\n", 0, false, []result{{"a", lineEndCRLF}, {"b\rc", lineEndCRLF}}},
+	}
+
+	for _, test := range tests {
+		lr := newLineReader(iotest.OneByteReader(strings.NewReader(test.input)), test.maxLen, test.truncate)
+		var got []result
+		for {
+			text, end, err := lr.readLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("input %q: %s", test.input, err)
+			}
+			got = append(got, result{string(text), end})
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("input %q: got %v, want %v", test.input, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("input %q: got %v, want %v", test.input, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLineReaderSplitCR(t *testing.T) {
+	type result struct {
+		text string
+		end  lineEnd
+	}
+
+	tests := []struct {
+		input    string
+		maxLen   int
+		truncate bool
+		want     []result
+	}{
+		{"a\rb\r\nc\nd\r", 0, false, []result{
+			{"a", lineEndCR}, {"b", lineEndCRLF}, {"c", lineEndNewline}, {"d", lineEndCR}}},
+		{"\r\r", 0, false, []result{{"", lineEndCR}, {"", lineEndCR}}},
+		{"abc\r\nd\n", 3, false, []result{{"abc", lineEndCRLF}, {"d", lineEndNewline}}},
+		{"abcd\r\ne\n", 3, true, []result{{"abc", lineEndTruncatedCRLF}, {"e", lineEndNewline}}},
+		{"abcd\rf\n", 3, true, []result{{"abc", lineEndTruncatedCR}, {"f", lineEndNewline}}},
+		{"abcd\r", 3, true, []result{{"abc", lineEndTruncatedCR}}},
+	}
+
+	for _, test := range tests {
+		lr := newLineReader(iotest.OneByteReader(strings.NewReader(test.input)), test.maxLen, test.truncate)
+		lr.splitCR = true
+		var got []result
+		for {
+			text, end, err := lr.readLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("input %q: %s", test.input, err)
+			}
+			got = append(got, result{string(text), end})
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("input %q: got %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestLineReaderPending(t *testing.T) {
+	lr := newLineReader(strings.NewReader(""), 0, false)
+	for _, test := range []struct {
+		data    string
+		splitCR bool
+		want    string
+	}{
+		{"abc", false, "abc"},
+		{"abc\r", false, "abc"},
+		{"a\rbc", false, "a\rbc"},
+		{"a\rbc", true, ""},
+		{"abc\r", true, "abc"},
+		{"abc\n", false, ""},
+	} {
+		lr.splitCR = test.splitCR
+		lr.beg, lr.end = 0, copy(lr.buf, test.data)
+		if got := string(lr.pending()); got != test.want {
+			t.Errorf("data %q, splitCR %v: got %q, want %q", test.data, test.splitCR, got, test.want)
+		}
+	}
+}
+
+func TestLineReaderWaiting(t *testing.T) {
+	lr := newLineReader(iotest.OneByteReader(strings.NewReader("ab\ncd")), 0, false)
+	var got []string
+	var snapshots [][]byte
+	lr.waiting = func(pending []byte) {
+		got = append(got, string(pending))
+		snapshots = append(snapshots, pending)
+	}
+	for {
+		if _, _, err := lr.readLine(); err != nil {
+			break
+		}
+	}
+	want := []string{"a", "ab", "c", "cd"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// The incomplete lines must not change as more is read.
+	for i, pending := range snapshots {
+		if string(pending) != want[i] {
+			t.Errorf("incomplete line %d changed to %q, want %q", i, pending, want[i])
+		}
+	}
+}
+
+func TestLineReaderError(t *testing.T) {
+	lr := newLineReader(iotest.TimeoutReader(strings.NewReader("a\nb")), 0, false)
+	if text, _, err := lr.readLine(); err != nil || string(text) != "a" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	if text, end, err := lr.readLine(); err != nil || string(text) != "b" || end != lineEndEOF {
+		t.Fatalf("got %q, %v, %v", text, end, err)
+	}
+	if _, _, err := lr.readLine(); err != iotest.ErrTimeout {
+		t.Fatalf("got %v, want %v", err, iotest.ErrTimeout)
+	}
+}
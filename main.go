@@ -2,28 +2,26 @@ package main
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"github.com/mattn/go-colorable"
 	"github.com/mattn/go-isatty"
 	"io"
 	"os"
 	"runtime"
-	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	cpuProfileEnabled = false
-
-	colorOutputEnabled = os.Getenv("TERM") != "dumb" &&
-		(isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()))
-
 	outputStream = io.Writer(os.Stdout)
 	errorStream  = os.Stderr
 )
 
 func init() {
-	// This application does not use any threads.
+	// The goroutines reading input sources, forwarding signals and watching
+	// for config reloads mostly block, processing lines is sequential.
 	// Limiting GOMAXPROCS seems to have a positive effect on GC performance.
 	runtime.GOMAXPROCS(1)
 }
@@ -32,7 +30,41 @@ func main() {
 	// There is some impedance mismatch between the stdlib flag package and my brain.
 	// Parse flags using custom code as there are so few of them.
 
-	var configFile string
+	var configFile, followFile string
+	var args, commandArgs []string
+	prefixSource := false
+	numberLines := false
+	timeFormat := ""
+	commandPTY := false
+	checkConfig := false
+	printStats := false
+	var partialTimeout time.Duration
+	maxLineLen := 0
+	var selection selectionSpec
+	contextBefore, contextAfter := 0, 0
+	truncateLines := false
+	splitCR := false
+	var inputCharset *charset
+	var prof profiles
+	colorWhen := colorAuto
+
+	setMaxLineLen := func(s string) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			fatalf("invalid maximum line length %q\n", s)
+		}
+		maxLineLen = n
+	}
+
+	contextArg := func(n *int) func(string) {
+		return func(s string) {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				fatalf("invalid number of context lines %q\n", s)
+			}
+			*n = v
+		}
+	}
 
 	setConfigFile := func(s string) {
 		if configFile == "" {
@@ -43,87 +75,259 @@ func main() {
 		}
 	}
 
-	configState := false
-	for _, arg := range os.Args[1:] {
-		if configState {
-			setConfigFile(arg)
-			configState = false
+	setFollowFile := func(s string) {
+		if followFile == "" {
+			followFile = s
+		} else {
+			briefUsage()
+			exitFail()
+		}
+	}
+
+	// Consumes the argument of the previous flag.
+	var argHandler func(string)
+
+	for i, arg := range os.Args[1:] {
+		if argHandler != nil {
+			argHandler(arg)
+			argHandler = nil
+		} else if arg == "--" {
+			commandArgs = os.Args[i+2:]
+			break
 		} else {
 			if len(arg) > 0 && arg[0] == '-' {
 				switch arg {
 				case "-color":
-					colorOutputEnabled = true
+					colorWhen = colorAlways
 				case "-config":
-					configState = true
+					argHandler = setConfigFile
+				case "-follow":
+					argHandler = setFollowFile
+				case "-max-line-length":
+					argHandler = setMaxLineLen
+				case "-truncate":
+					truncateLines = true
+				case "-cr":
+					splitCR = true
+				case "-encoding":
+					argHandler = func(s string) {
+						cs, err := findCharset(s)
+						if err != nil {
+							fatalln(err.Error())
+						}
+						inputCharset = cs
+					}
+				case "-select":
+					argHandler = func(s string) { selection.filters = append(selection.filters, s) }
+				case "-select-cond":
+					argHandler = func(s string) { selection.cond = s }
+				case "-invert":
+					selection.invert = true
+				case "-A":
+					argHandler = contextArg(&contextAfter)
+				case "-B":
+					argHandler = contextArg(&contextBefore)
+				case "-C":
+					argHandler = func(s string) {
+						contextArg(&contextBefore)(s)
+						contextAfter = contextBefore
+					}
+				case "-prefix":
+					prefixSource = true
+				case "-number":
+					numberLines = true
+				case "-time":
+					timeFormat = defaultTimeFormat
+				case "-time-format":
+					argHandler = func(s string) { timeFormat = s }
+				case "-pty":
+					commandPTY = true
+				case "-partial":
+					argHandler = func(s string) {
+						d, err := time.ParseDuration(s)
+						if err != nil || d <= 0 {
+							fatalf("invalid partial line timeout %q\n", s)
+						}
+						partialTimeout = d
+					}
+				case "-cpuprofile":
+					argHandler = func(s string) { prof.cpu = s }
+				case "-memprofile":
+					argHandler = func(s string) { prof.mem = s }
+				case "-trace":
+					argHandler = func(s string) { prof.trace = s }
+				case "-stats":
+					printStats = true
+				case "-check":
+					checkConfig = true
+				case "-list":
+					if err := listConfigs(os.Stdout); err != nil {
+						fatalln(err.Error())
+					}
+					exitSuccess()
 				case "-help", "--help" /* GNU concession */ :
 					detailedUsage()
 					exitSuccess()
 				default:
+					if s, ok := strings.CutPrefix(arg, "-color="); ok {
+						var err error
+						if colorWhen, err = parseColorMode(s); err != nil {
+							fatalln(err.Error())
+						}
+						break
+					}
 					detailedUsage()
 					exitFail()
 				}
 			} else {
-				configDir, err := userConfigDir()
-				if err != nil {
-					fatalf("unable to find user config directory: %s\n", err)
-				}
-				setConfigFile(configDir + "/rainbow/" + arg + ".rainbow")
+				args = append(args, arg)
 			}
 		}
 	}
 
-	if configState || configFile == "" {
+	// The first non-flag argument names the config unless one was given using
+	// the -config flag. Any other arguments are input files. An existing file
+	// not naming a config is an input file, the config is then detected.
+	if configFile == "" && len(args) > 0 {
+		path, err := resolveConfig(args[0])
+		if err == nil {
+			setConfigFile(path)
+			args = args[1:]
+		} else if info, statErr := os.Stat(args[0]); statErr != nil || info.IsDir() {
+			fatalln(err.Error())
+		}
+	}
+
+	// The config is detected from the input if not given.
+	detectConfig := configFile == ""
+
+	if argHandler != nil || checkConfig && detectConfig {
+		briefUsage()
+		exitFail()
+	}
+	if commandArgs != nil && (len(commandArgs) == 0 || len(args) > 0 || followFile != "") ||
+		commandPTY && commandArgs == nil {
 		briefUsage()
 		exitFail()
 	}
 
-	if cpuProfileEnabled {
-		f, err := os.Create("rainbow-cpu.pprof")
-		if err == nil {
-			pprof.StartCPUProfile(f)
-			defer pprof.StopCPUProfile()
+	if err := prof.start(commandArgs == nil); err != nil {
+		fatalf("failed to start profiling: %s\n", err)
+	}
+
+	prog := newProgram("<none>")
+	if !detectConfig {
+		var err error
+		if prog, err = loadProgram(configFile); err != nil {
+			fatalf("failed to read config: %s\n", err)
 		}
-		colorOutputEnabled = true
 	}
 
-	prog, err := loadProgram(configFile)
-	if err != nil {
-		fatalf("failed to read config: %s\n", err)
+	if checkConfig {
+		for _, warning := range prog.check(configFile) {
+			fmt.Fprintln(errorStream, warning)
+		}
+		exitSuccess()
 	}
 
+	colorOutputEnabled := colorEnabled(colorWhen, os.Getenv,
+		isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()))
+
 	encoder := textEncoderDummy
 	if colorOutputEnabled {
 		outputStream = colorable.NewColorableStdout()
 		encoder = textEncoderANSI
 	}
 
-	bufferedOutputStream := bufio.NewWriter(outputStream)
-
-	line := newLine()
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		// The line object and its state objects are reused beteween each line. The byte
-		// slice for the line content itself is uniquely allocated for each line as it's
-		// saved in a match history for match comparisons.
-		line.init(append([]byte(nil), scanner.Bytes()...))
-
-		if err = line.applyProgram(prog); err != nil {
+	proc := newProcessor(prog, bufio.NewWriter(outputStream), encoder)
+	proc.prefixSource = prefixSource
+	proc.numberLines = numberLines
+	proc.timeFormat = timeFormat
+	proc.maxLineLen = maxLineLen
+	proc.truncate = truncateLines
+	proc.splitCR = splitCR
+	proc.charset = inputCharset
+	proc.selection = selection
+	if contextBefore > 0 || contextAfter > 0 {
+		proc.context = newLineContext(contextBefore, contextAfter)
+	}
+	proc.partialTimeout = partialTimeout
+	proc.rerender = colorOutputEnabled
+	if detectConfig {
+		proc.detector = newConfigDetector()
+		proc.detector.detected = func(path string) {
+			proc.reloader = newConfigReloader(path, proc.prog)
+			proc.reloader.start()
+		}
+	} else {
+		if err := proc.setProgram(prog); err != nil {
 			fatalln(err.Error())
 		}
+		proc.reloader = newConfigReloader(configFile, prog)
+		proc.reloader.start()
+	}
+	if printStats {
+		proc.stats = newLineStats()
+		proc.printStatsOnSignal(errorStream)
+	}
 
-		if err = line.output(bufferedOutputStream, encoder); err == nil {
-			err = bufferedOutputStream.Flush()
+	if commandArgs != nil {
+		start := startCommand
+		if commandPTY {
+			start = startCommandPTY
+		}
+		cmd, err := start(commandArgs)
+		if err != nil {
+			fatalf("failed to start command: %s\n", err)
+		}
+		if err = proc.processConcurrently(cmd.sources); err != nil {
+			fatalln(err.Error())
+		}
+		if err = proc.detectProgram(); err != nil {
+			fatalln(err.Error())
 		}
+		exitCode, err := cmd.wait()
 		if err != nil {
-			fatalf("failed to output line: %s\n", err)
+			fatalf("failed to wait for command: %s\n", err)
+		}
+		if printStats {
+			proc.printStats(errorStream)
+		}
+		exit(exitCode)
+	}
+
+	var sources []*inputSource
+	for _, arg := range args {
+		sources = append(sources, newFileSource(arg))
+	}
+	if followFile != "" {
+		sources = append(sources, newFollowSource(followFile))
+	}
+	if len(sources) == 0 {
+		sources = append(sources, newStdinSource())
+	}
+
+	for _, src := range sources {
+		if err := proc.processSource(src); err != nil {
+			fatalln(err.Error())
 		}
 	}
+	if err := proc.detectProgram(); err != nil {
+		fatalln(err.Error())
+	}
+	if printStats {
+		proc.printStats(errorStream)
+	}
+	exitSuccess()
 }
 
+// Default format of times in line prefixes.
+const defaultTimeFormat = "15:04:05.000"
+
 func detailedUsage() {
 	errorStream.Write([]byte(`Rainbow is a log file colorer that act as a stream processor. Match and action
-rules are applied according to configuration to each line read from stdin,
-outputting them to stdout.
+rules are applied according to configuration to each line read from stdin or
+the listed files, outputting them to stdout.
 
 `))
 	briefUsage()
@@ -133,34 +337,65 @@ func briefUsage() {
 	errorStream.Write([]byte(`Usage:
 
     -help         Show help
-    -color        Force color for non-TTY output
+    -color=WHEN   Color output always, never or auto, the default. Auto colors
+                  terminal output unless overridden by NO_COLOR, FORCE_COLOR,
+                  CLICOLOR or CLICOLOR_FORCE. -color is short for -color=always
     -config FILE  Use config FILE
-    CONFIG        Use config from ~/.config/rainbow/CONFIG.rainbow 
+    -follow FILE  Read FILE instead of stdin, waiting for appended data and
+                  reopening it when rotated or truncated
+    -prefix       Prefix each line with the name of its input file
+    -number       Prefix each line with its line number in its input file
+    -time         Prefix each line with the time it was read, e.g. 15:04:05.000
+    -time-format LAYOUT
+                  Prefix each line with the time it was read using the Go time
+                  LAYOUT, e.g. "2006-01-02 15:04:05.000"
+    -select FILTER
+                  Only output lines matched by FILTER, may be repeated
+    -select-cond EXPR
+                  Only output lines for which the condition EXPR is true
+    -invert       Only output lines not selected by the above
+    -A N          Output N dimmed context lines after selected lines
+    -B N          Output N dimmed context lines before selected lines
+    -C N          Output N dimmed context lines before and after selected lines
+    -partial DURATION
+                  Output incomplete lines after no input for DURATION, e.g. 100ms
+    -stats        Print match statistics to stderr at end of input or on SIGUSR1
+    -max-line-length N
+                  Split lines longer than N bytes, marking the split with '↵'
+    -truncate     Truncate lines longer than the maximum line length instead,
+                  marking the truncation with '…'
+    -cr           End lines at bare carriage returns, overwriting the line on
+                  terminals as for progress updates
+    -encoding NAME
+                  Convert input of encoding NAME to UTF-8, e.g. latin1
+    -cpuprofile FILE
+                  Write a CPU profile to FILE
+    -memprofile FILE
+                  Write a memory profile to FILE when exiting
+    -trace FILE   Write an execution trace to FILE
+    -list         List configs found in the config search path
+    -check        Check config for errors and print warnings, then exit
+    CONFIG        Use config CONFIG.rainbow from the config search path,
+                  detected from the first lines of input if not given or if
+                  naming an existing file rather than a config
+    FILE...       Read files in order instead of stdin
+    -- CMD ARG... Run CMD and read its stdout and stderr instead of stdin,
+                  exiting with the exit code of CMD
+    -pty          Run CMD on a pseudo-terminal (Linux only)
 
 Example:
 
     rainbow config < logfile
+    rainbow < logfile
+    rainbow -prefix config a.log b.log
+    rainbow -select logLevel config < logfile
+    rainbow config -- make test
+    rainbow -check config
+    rainbow -pty config -- ls --color=auto
+    rainbow -follow /var/log/syslog config
 `))
 }
 
-// TODO(jb): Support for other platforms than Linux.
-//
-// This is currently Linix centric.
-// There is the os.UserCacheDir() but I don't think that is the correct place to put user config files.
-func userConfigDir() (string, error) {
-	var dir string
-
-	switch runtime.GOOS {
-	default:
-		dir = os.Getenv("HOME")
-		if dir == "" {
-			return "", errors.New("$HOME is not defined")
-		}
-		dir += "/.config"
-	}
-	return dir, nil
-}
-
 func fatalf(format string, a ...interface{}) {
 	fmt.Fprintf(errorStream, format, a...)
 	exitFail()
@@ -171,10 +406,31 @@ func fatalln(a ...interface{}) {
 	exitFail()
 }
 
+var (
+	atExitFuncs []func()
+	exitMu      sync.Mutex // Held while exiting, never released
+)
+
+// atExit registers f to be called by exit. Functions are called in reverse
+// order of registration.
+func atExit(f func()) {
+	atExitFuncs = append(atExitFuncs, f)
+}
+
+// exit calls the functions registered by atExit and exits with code. It may be
+// called from any goroutine.
+func exit(code int) {
+	exitMu.Lock()
+	for i := len(atExitFuncs) - 1; i >= 0; i-- {
+		atExitFuncs[i]()
+	}
+	os.Exit(code)
+}
+
 func exitSuccess() {
-	os.Exit(0)
+	exit(0)
 }
 
 func exitFail() {
-	os.Exit(1)
+	exit(1)
 }
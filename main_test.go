@@ -2,8 +2,12 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 func testApplyConfigToLog(configPath, logPath string) {
@@ -20,89 +24,629 @@ func testApplyConfigToLog(configPath, logPath string) {
 	}
 	defer log.Close()
 
-	line := newLine()
-	scanner := bufio.NewScanner(log)
-	for scanner.Scan() {
-		// The line object and its state objects are reused beteween each line. The byte
-		// slice for the line content itself is uniquely allocated for each line as it's
-		// saved in a match history for match comparisons.
-		line.init(append([]byte(nil), scanner.Bytes()...))
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderTest)
+	if err = proc.process(newFileSource(logPath), log); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func Example_exampleConfig() {
+	testApplyConfigToLog("testdata/config/example.rainbow", "testdata/logs/example.log")
+	// Output:
+	// fg:cyan,bg:none,mod:[]                  {2018-08-25 }
+	// fg:cyan,bg:none,mod:[bold]              {12:55:33}
+	// fg:cyan,bg:none,mod:[]                  {.123 [DEBUG]  Bob:   movement detected; }
+	// fg:cyan,bg:none,mod:[bold]              {sector}
+	// fg:cyan,bg:none,mod:[]                  {=X2 }
+	// fg:cyan,bg:none,mod:[bold]              {count}
+	// fg:cyan,bg:none,mod:[]                  {=3}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:none,bg:none,mod:[]                  {2018-08-25 12:55:33.125 [NOTICE] }
+	// fg:none,bg:none,mod:[bold]              {Bob}
+	// fg:none,bg:none,mod:[]                  {:   informing Fred of movement; }
+	// fg:none,bg:none,mod:[bold]              {sector}
+	// fg:none,bg:none,mod:[]                  {=X2}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:iblack,bg:none,mod:[]                {2018-08-25 }
+	// fg:iblack,bg:none,mod:[bold]            {12:55:34}
+	// fg:iblack,bg:none,mod:[]                {.001 [INFO]   Fred:  dispatching drones; }
+	// fg:iblack,bg:none,mod:[bold]            {targetSector}
+	// fg:iblack,bg:none,mod:[]                {=X2}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:none,bg:none,mod:[]                  {2018-08-25 12:55:34.001 [}
+	// fg:white,bg:red,mod:[bold]              {CRIT}
+	// fg:none,bg:none,mod:[]                  {]   }
+	// fg:none,bg:none,mod:[bold]              {Drone}
+	// fg:none,bg:none,mod:[]                  {: damage detected; }
+	// fg:none,bg:none,mod:[bold]              {droneID}
+	// fg:none,bg:none,mod:[]                  {=3 }
+	// fg:none,bg:none,mod:[bold]              {sensor}
+	// fg:none,bg:none,mod:[]                  {=hull/3 }
+	// fg:none,bg:none,mod:[bold]              {action}
+	// fg:none,bg:none,mod:[]                  {=returnHome}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:none,bg:none,mod:[]                  {2018-08-25 12:55:34.002 [}
+	// fg:white,bg:red,mod:[bold]              {EMERG}
+	// fg:none,bg:none,mod:[]                  {]  }
+	// fg:none,bg:none,mod:[bold]              {Drone}
+	// fg:none,bg:none,mod:[]                  {: damage detected; }
+	// fg:none,bg:none,mod:[bold]              {droneID}
+	// fg:none,bg:none,mod:[]                  {=3 }
+	// fg:none,bg:none,mod:[bold]              {sensor}
+	// fg:none,bg:none,mod:[]                  {=engine/1 }
+	// fg:none,bg:none,mod:[bold]              {action}
+	// fg:none,bg:none,mod:[]                  {=selfDestruct}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:none,bg:none,mod:[]                  {2018-08-25 }
+	// fg:none,bg:none,mod:[bold]              {12:55:35}
+	// fg:none,bg:none,mod:[]                  {.888 [}
+	// fg:black,bg:yellow,mod:[]               {WARN}
+	// fg:none,bg:none,mod:[]                  {]   }
+	// fg:none,bg:none,mod:[bold]              {Fred}
+	// fg:none,bg:none,mod:[]                  {:  lost drone; }
+	// fg:none,bg:none,mod:[bold]              {droneID}
+	// fg:none,bg:none,mod:[]                  {=3 }
+	// fg:none,bg:none,mod:[bold]              {lastPosition}
+	// fg:none,bg:none,mod:[]                  {=X2/3:7}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+}
+
+func testApplyConfigToSources(config string, prefixSource bool, sources ...*inputSource) {
+	prog, err := createProgram(strings.NewReader(config))
+	if err != nil {
+		fmt.Printf("failed to read config: %s\n", err)
+		return
+	}
 
-		if err = line.applyProgram(prog); err != nil {
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderTest)
+	proc.prefixSource = prefixSource
+	for _, src := range sources {
+		if err = proc.processSource(src); err != nil {
 			fmt.Println(err.Error())
 			return
 		}
+	}
+}
 
-		if err = line.output(os.Stdout, textEncoderTest); err != nil {
-			fatalf("failed to output line: %s\n", err)
-			return
+func newStringSource(name, text string) *inputSource {
+	return newInputSource(name, func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(text)), nil
+	})
+}
+
+func Example_sourceCondition() {
+	testApplyConfigToSources(`{
+		filter: { name: all regexp: "^(.*)$" properties: { 1: { color: red } } }
+		apply: { cond: [source? b] filters: all }
+	}`, true, newStringSource("a", "x\n"), newStringSource("b", "y\n"))
+	// Output:
+	// fg:green,bg:none,mod:[]                 {a}
+	// fg:none,bg:none,mod:[]                  {: }
+	// fg:none,bg:none,mod:[]                  {x}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:iblue,bg:none,mod:[]                 {b}
+	// fg:none,bg:none,mod:[]                  {: }
+	// fg:red,bg:none,mod:[]                   {y}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+}
+
+func testSelectLines(spec selectionSpec) {
+	prog, err := loadProgram("testdata/config/example.rainbow")
+	if err != nil {
+		fmt.Printf("failed to read config: %s\n", err)
+		return
+	}
+
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderDummy)
+	proc.selection = spec
+	if err = proc.setProgram(prog); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = proc.processSource(newFileSource("testdata/logs/example.log")); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func testRunCommand(config string, args ...string) {
+	prog, err := createProgram(strings.NewReader(config))
+	if err != nil {
+		fmt.Printf("failed to read config: %s\n", err)
+		return
+	}
+
+	cmd, err := startCommand(args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderTest)
+	if err = proc.processConcurrently(cmd.sources); err != nil {
+		fmt.Println(err.Error())
+	}
+	exitCode, err := cmd.wait()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println("exit code", exitCode)
+}
+
+func Example_command() {
+	const stderrConfig = `{
+		filter: { name: all regexp: "^(.*)$" properties: { 1: { color: red } } }
+		apply: { cond: [source? stderr] filters: all }
+	}`
+	testRunCommand(stderrConfig, "sh", "-c", "echo out; exit 3")
+	testRunCommand(stderrConfig, "sh", "-c", "echo err >&2")
+
+	testRunCommand(`{
+		filter: { name: all regexp: "^(.*)$" }
+		apply: { filters: all }
+	}`, "sh", "-c", "kill -TERM $$")
+	// Output:
+	// fg:none,bg:none,mod:[]                  {out}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// exit code 3
+	// fg:red,bg:none,mod:[]                   {err}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// exit code 0
+	// exit code 143
+}
+
+func Example_selectFilter() {
+	testSelectLines(selectionSpec{filters: []string{"logLevel/info", "logLevel/debug"}, invert: true})
+	// Output:
+	// 2018-08-25 12:55:33.125 [NOTICE] Bob:   informing Fred of movement; sector=X2
+	// 2018-08-25 12:55:34.001 [CRIT]   Drone: damage detected; droneID=3 sensor=hull/3 action=returnHome
+	// 2018-08-25 12:55:34.002 [EMERG]  Drone: damage detected; droneID=3 sensor=engine/1 action=selfDestruct
+	// 2018-08-25 12:55:35.888 [WARN]   Fred:  lost drone; droneID=3 lastPosition=X2/3:7
+}
+
+func Example_selectCond() {
+	testSelectLines(selectionSpec{cond: "[not [equal? [filter-result time 0] [filter-result time 1]]]"})
+	// Output:
+	// 2018-08-25 12:55:33.123 [DEBUG]  Bob:   movement detected; sector=X2 count=3
+	// 2018-08-25 12:55:34.001 [INFO]   Fred:  dispatching drones; targetSector=X2
+	// 2018-08-25 12:55:35.888 [WARN]   Fred:  lost drone; droneID=3 lastPosition=X2/3:7
+}
+
+func Example_selectContext() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: a regexp: "^(3|7|8)$" }
+		apply: { filters: a }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderDummy)
+	proc.selection = selectionSpec{filters: []string{"a"}}
+	proc.context = newLineContext(1, 1)
+	if err = proc.setProgram(prog); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = proc.processSource(newStringSource("numbers", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")); err != nil {
+		fmt.Println(err.Error())
+	}
+	// Output:
+	// 2
+	// 3
+	// 4
+	// --
+	// 6
+	// 7
+	// 8
+	// 9
+}
+
+func Example_stats() {
+	prog, err := loadProgram("testdata/config/example.rainbow")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	log, err := os.Open("testdata/logs/example.log")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer log.Close()
+
+	proc := newProcessor(prog, bufio.NewWriter(io.Discard), textEncoderDummy)
+	proc.stats = newLineStats()
+	if err = proc.process(newFileSource("example.log"), log); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	// Leave out the first line with the elapsed time and rate.
+	var buf bytes.Buffer
+	proc.printStats(&buf)
+	_, report, _ := strings.Cut(buf.String(), "\n")
+	fmt.Print(report)
+	// Output:
+	// FILTER          POSITION  MATCHED LINES
+	// logLevel        10:12     -
+	// logLevel/-      13:16     3
+	// logLevel/info   32:16     1
+	// logLevel/debug  42:16     1
+	// time            53:12     6
+	// timeHighlight   57:12     3
+	// domain          66:12     4
+	// variable        75:12     6
+	//
+	// APPLY  POSITION  APPLIED LINES
+	// 1      85:11     6
+	// 2      88:11     3
+	// 3      93:11     4
+	// 4      97:11     6
+}
+
+func Example_check() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: a regexp: "(x)" properties: { 2: { color: red } } }
+		filter: { name: b regexp: "y" }
+		apply: { cond: [filter-match? c] filters: a }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for _, warning := range prog.check("") {
+		fmt.Println(warning)
+	}
+
+	const configFile = "testdata/config/include/unused.rainbow"
+	if prog, err = loadProgram(configFile); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for _, warning := range prog.check(configFile) {
+		fmt.Println(warning)
+	}
+	// Output:
+	// 2:62: warning: regexp group 2 does not exist, the regexp has 1 groups
+	// 3:24: warning: filter "b" is never applied or referenced
+	// 4:31: warning: filter-match?: filter "c" does not exist
+	// testdata/config/include/diamond-base.rainbow:2:12: warning: filter "drone" is never applied or referenced
+	// testdata/config/include/unused.rainbow:9:12: warning: filter "unused" is never applied or referenced
+}
+
+func Example_partialLine() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: b regexp: "(b+)" properties: { 1: { color: red } } }
+		apply: { filters: b }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	src := newStringSource("prompt", "")
+
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderDummy)
+	proc.outputPartial(src, []byte("ab"))
+	proc.outputPartial(src, []byte("abb"))
+	proc.processLine(src, []byte("abbc"), lineEndNewline, time.Now())
+
+	var buf bytes.Buffer
+	proc = newProcessor(prog, bufio.NewWriter(&buf), textEncoderDummy)
+	proc.rerender = true
+	proc.outputPartial(src, []byte("ab"))
+	proc.processLine(src, []byte("abc"), lineEndNewline, time.Now())
+	fmt.Printf("%q\n", buf.String())
+	// Output:
+	// abbc
+	// "ab\r\x1b[2Kabc\n"
+}
+
+func Example_partialSources() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: a regexp: "a" }
+		apply: { filters: a }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	// Both sources wait for the rest of a line at the same time.
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	go func() {
+		w1.Write([]byte("a> "))
+		time.Sleep(50 * time.Millisecond)
+		w2.Write([]byte("b> "))
+		time.Sleep(500 * time.Millisecond)
+		w1.Close()
+		w2.Close()
+	}()
+
+	var buf bytes.Buffer
+	proc := newProcessor(prog, bufio.NewWriter(&buf), textEncoderDummy)
+	proc.partialTimeout = 100 * time.Millisecond
+	if err = proc.processConcurrently([]*inputSource{newPipeSource("1", r1), newPipeSource("2", r2)}); err != nil {
+		fmt.Println(err.Error())
+	}
+	// The lines completed at the end of input are output in any order.
+	lines := strings.SplitAfter(buf.String(), "\n")
+	fmt.Printf("%q\n", lines[:2])
+	// Output:
+	// ["a> \n" "b> \n"]
+}
+
+func Example_lineEndings() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: end regexp: "(b)$" properties: { 1: { color: red } } }
+		apply: { filters: end }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	proc := newProcessor(prog, bufio.NewWriter(&buf), textEncoderANSI)
+	if err = proc.processSource(newStringSource("crlf", "ab\r\nb\n")); err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Printf("%q\n", buf.String())
+
+	buf.Reset()
+	proc = newProcessor(prog, bufio.NewWriter(&buf), textEncoderDummy)
+	proc.splitCR = true
+	proc.rerender = true
+	if err = proc.processSource(newStringSource("progress", "10%\r20%\rdone\n")); err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Printf("%q\n", buf.String())
+
+	buf.Reset()
+	proc = newProcessor(prog, bufio.NewWriter(&buf), textEncoderDummy)
+	proc.maxLineLen = 4
+	proc.truncate = true
+	if err = proc.processSource(newStringSource("truncated", "aaaaaaaaaa\r\nb\n")); err != nil {
+		fmt.Println(err.Error())
+	}
+	fmt.Printf("%q\n", buf.String())
+	// Output:
+	// "a\x1b[31mb\x1b[0m\r\n\x1b[31mb\x1b[0m\n"
+	// "10%\r\r\x1b[2K20%\r\r\x1b[2Kdone\n"
+	// "aaaa…\r\nb\n"
+}
+
+func Example_encoding() {
+	testApplyConfigToSources(`{
+		encoding: latin1
+		filter: { name: word regexp: "^(\\pL+)" properties: { 1: { color: red } } }
+		apply: { filters: word }
+	}`, false, newStringSource("latin1", "s\xe5g\n"))
+
+	testApplyConfigToSources(`{
+		filter: { name: word regexp: "^(\\w+)" properties: { 1: { color: red } } }
+		apply: { filters: word }
+	}`, false, newStringSource("utf-8", "ok\xff\n"))
+	// Output:
+	// fg:red,bg:none,mod:[]                   {såg}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:red,bg:none,mod:[]                   {ok}
+	// fg:none,bg:none,mod:[reverse]           {�}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+}
+
+func Example_linePrefix() {
+	prog, err := createProgram(strings.NewReader(`{
+		filter: { name: all regexp: "^(.*)$" }
+		apply: { filters: all }
+	}`))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	src := newStringSource("a", "")
+	received := time.Date(2026, 10, 17, 21, 34, 0, 0, time.UTC)
+
+	proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderDummy)
+	proc.prefixSource = true
+	proc.numberLines = true
+	proc.timeFormat = defaultTimeFormat
+	proc.selection = selectionSpec{cond: "[line-range? 2 3]"}
+	if err = proc.setProgram(prog); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for _, text := range []string{"x", "y", "z", "w"} {
+		if err = proc.processLine(src, []byte(text), lineEndNewline, received); err != nil {
+			fmt.Println(err.Error())
 		}
 	}
+	// Output:
+	// 21:34:00.000 a:2: y
+	// 21:34:00.000 a:3: z
 }
 
-func Example_1() {
-	testApplyConfigToLog("testdata/config/example.rainbow", "testdata/logs/example.log")
-	//Output:
-	//fg:cyan,bg:none,mod:[]                  {2018-08-25 }
-	//fg:cyan,bg:none,mod:[bold]              {12:55:33}
-	//fg:cyan,bg:none,mod:[]                  {.123 [DEBUG]  Bob:   movement detected; }
-	//fg:cyan,bg:none,mod:[bold]              {sector}
-	//fg:cyan,bg:none,mod:[]                  {=X2 }
-	//fg:cyan,bg:none,mod:[bold]              {count}
-	//fg:cyan,bg:none,mod:[]                  {=3}
-	//fg:none,bg:none,mod:[]                  {
-	//}
-	//fg:none,bg:none,mod:[]                  {2018-08-25 12:55:33.125 [NOTICE] }
-	//fg:none,bg:none,mod:[bold]              {Bob}
-	//fg:none,bg:none,mod:[]                  {:   informing Fred of movement; }
-	//fg:none,bg:none,mod:[bold]              {sector}
-	//fg:none,bg:none,mod:[]                  {=X2}
-	//fg:none,bg:none,mod:[]                  {
-	//}
-	//fg:iblack,bg:none,mod:[]                {2018-08-25 }
-	//fg:iblack,bg:none,mod:[bold]            {12:55:34}
-	//fg:iblack,bg:none,mod:[]                {.001 [INFO]   Fred:  dispatching drones; }
-	//fg:iblack,bg:none,mod:[bold]            {targetSector}
-	//fg:iblack,bg:none,mod:[]                {=X2}
-	//fg:none,bg:none,mod:[]                  {
-	//}
-	//fg:none,bg:none,mod:[]                  {2018-08-25 12:55:34.001 [}
-	//fg:white,bg:red,mod:[bold]              {CRIT}
-	//fg:none,bg:none,mod:[]                  {]   }
-	//fg:none,bg:none,mod:[bold]              {Drone}
-	//fg:none,bg:none,mod:[]                  {: damage detected; }
-	//fg:none,bg:none,mod:[bold]              {droneID}
-	//fg:none,bg:none,mod:[]                  {=3 }
-	//fg:none,bg:none,mod:[bold]              {sensor}
-	//fg:none,bg:none,mod:[]                  {=hull/3 }
-	//fg:none,bg:none,mod:[bold]              {action}
-	//fg:none,bg:none,mod:[]                  {=returnHome}
-	//fg:none,bg:none,mod:[]                  {
-	//}
-	//fg:none,bg:none,mod:[]                  {2018-08-25 12:55:34.002 [}
-	//fg:white,bg:red,mod:[bold]              {EMERG}
-	//fg:none,bg:none,mod:[]                  {]  }
-	//fg:none,bg:none,mod:[bold]              {Drone}
-	//fg:none,bg:none,mod:[]                  {: damage detected; }
-	//fg:none,bg:none,mod:[bold]              {droneID}
-	//fg:none,bg:none,mod:[]                  {=3 }
-	//fg:none,bg:none,mod:[bold]              {sensor}
-	//fg:none,bg:none,mod:[]                  {=engine/1 }
-	//fg:none,bg:none,mod:[bold]              {action}
-	//fg:none,bg:none,mod:[]                  {=selfDestruct}
-	//fg:none,bg:none,mod:[]                  {
-	//}
-	//fg:none,bg:none,mod:[]                  {2018-08-25 }
-	//fg:none,bg:none,mod:[bold]              {12:55:35}
-	//fg:none,bg:none,mod:[]                  {.888 [}
-	//fg:black,bg:yellow,mod:[]               {WARN}
-	//fg:none,bg:none,mod:[]                  {]   }
-	//fg:none,bg:none,mod:[bold]              {Fred}
-	//fg:none,bg:none,mod:[]                  {:  lost drone; }
-	//fg:none,bg:none,mod:[bold]              {droneID}
-	//fg:none,bg:none,mod:[]                  {=3 }
-	//fg:none,bg:none,mod:[bold]              {lastPosition}
-	//fg:none,bg:none,mod:[]                  {=X2/3:7}
-	//fg:none,bg:none,mod:[]                  {
-	//}
+func Example_include() {
+	for _, config := range []string{"service", "diamond", "duplicate", "cycle-a"} {
+		prog, err := loadProgram("testdata/config/include/" + config + ".rainbow")
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		proc := newProcessor(prog, bufio.NewWriter(os.Stdout), textEncoderTest)
+		err = proc.processSource(newStringSource("drone", "2018-08-25 12:55:35.888 [INFO] droneID=3\n"))
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+	// Output:
+	// fg:iblack,bg:none,mod:[]                {2018-08-25 }
+	// fg:iblack,bg:none,mod:[bold]            {12:55:35}
+	// fg:iblack,bg:none,mod:[]                {.888 [INFO] }
+	// fg:iblack,bg:none,mod:[bold]            {droneID}
+	// fg:iblack,bg:none,mod:[]                {=}
+	// fg:magenta,bg:none,mod:[]               {3}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:none,bg:none,mod:[]                  {2018-08-25 12:55:35.888 [INFO] droneID=}
+	// fg:magenta,bg:none,mod:[]               {3}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// testdata/config/include/duplicate.rainbow:4:12: duplicate filter "time", first defined at testdata/config/example.rainbow:53:12
+	// testdata/config/include/cycle-a.rainbow:2:13: testdata/config/include/cycle-b.rainbow:2:13: cyclic include: testdata/config/include/cycle-a.rainbow -> testdata/config/include/cycle-b.rainbow -> testdata/config/include/cycle-a.rainbow
+}
+
+func Example_define() {
+	testApplyConfigToSources(`{
+		define: { ts: "\\d{2}:\\d{2}" hi: red }
+		define: { tsGroup: "(${ts})" }
+		filter: { name: time regexp: "^${tsGroup} " properties: { 1: { color: "${hi}" } } }
+		apply: { filters: time }
+	}`, false, newStringSource("a", "12:34 x\n"))
+
+	for _, config := range []string{
+		`{ define: { ts: "(\\d" } filter: { name: a regexp: "${ts}" } apply: { filters: a } }`,
+		`{ filter: { name: a regexp: "${ts}" } apply: { filters: a } }`,
+		`{ define: { c: blu } filter: { name: a regexp: "(a)" properties: { 1: { color: "${c}" } } } apply: { filters: a } }`,
+		`{ define: { c: red } define: { c: blue } }`,
+	} {
+		if _, err := createProgram(strings.NewReader(config)); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Output:
+	// fg:red,bg:none,mod:[]                   {12:34}
+	// fg:none,bg:none,mod:[]                  { x}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// 1:51: error parsing regexp: missing closing ): `(\d`, using ${ts} defined at 1:12
+	// 1:28: undefined value "ts"
+	// 1:79: unknown color "blu", using ${c} defined at 1:12
+	// 1:31: duplicate definition "c", first defined at 1:12
+}
+
+func Example_namedGroups() {
+	testApplyConfigToSources(`{
+		filter: { name: level regexp: "^(?P<time>\\d+) (?P<level>[A-Z]+)" properties: { level: { color: red } 1: { color: blue } } }
+		filter: { name: ref regexpFrom: level properties: { time: { color: green } } }
+		apply: { filters: level }
+		apply: { cond: [and [equal? [filter-result level 0 level] INFO] [equal? [filter-result level 0 2] INFO]] filters: ref }
+	}`, false, newStringSource("a", "12 ERROR x\n34 INFO y\n"))
+
+	for _, config := range []string{
+		`{ filter: { name: a regexp: "(?P<x>a)" properties: { y: { color: red } } } apply: { filters: a } }`,
+		`{ filter: { name: a properties: { x: { color: red } } } apply: { filters: a } }`,
+		`{ filter: { name: a regexp: "(?P<x>a)" properties: { 1: { color: red } x: { color: blue } } } apply: { filters: a } }`,
+		`{ filter: { name: a regexp: "(?P<x>a)" } apply: { cond: [filter-result a 0 y] filters: a } }`,
+	} {
+		if _, err := createProgram(strings.NewReader(config)); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Output:
+	// fg:blue,bg:none,mod:[]                  {12}
+	// fg:none,bg:none,mod:[]                  { }
+	// fg:red,bg:none,mod:[]                   {ERROR}
+	// fg:none,bg:none,mod:[]                  { x}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// fg:green,bg:none,mod:[]                 {34}
+	// fg:none,bg:none,mod:[]                  { }
+	// fg:red,bg:none,mod:[]                   {INFO}
+	// fg:none,bg:none,mod:[]                  { y}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// 1:53: regexp group "y" does not exist
+	// 1:34: regexp group "x" does not exist, the filter has no regexp
+	// 1:71: duplicate properties of regexp group 1, first given at 1:53
+	// 1:56: filter-result: filter "a" has no regexp group "y"
+}
+
+func Example_wholeMatch() {
+	testApplyConfigToSources(`{
+		filter: {
+			name: kv
+			regexp: "(\\w+)=(\\w+)"
+			properties: { 0: { modifiers: bold } 2: { color: red } else: { color: blue } }
+		}
+		apply: { filters: kv }
+	}`, false, newStringSource("a", "x a=b y\n"))
+
+	if _, err := createProgram(strings.NewReader(`{ filter: { name: a regexp: "a" properties: { -1: { color: red } } } apply: { filters: a } }`)); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// fg:none,bg:none,mod:[]                  {x }
+	// fg:none,bg:none,mod:[bold]              {a}
+	// fg:blue,bg:none,mod:[bold]              {=}
+	// fg:red,bg:none,mod:[bold]               {b}
+	// fg:none,bg:none,mod:[]                  { y}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// 1:46: invalid regexp group "-1"
+}
+
+func Example_style() {
+	testApplyConfigToSources(`{
+		style: { name: error color: white bgcolor: red modifiers: bold }
+		style: { name: notice style: error bgcolor: blue }
+		filter: {
+			name: level
+			regexp: "^(ERROR) (NOTICE) (FATAL)"
+			properties: {
+				1: { style: error }
+				2: { style: notice }
+				3: { modifiers: underline style: error }
+			}
+		}
+		apply: { filters: level }
+	}`, false, newStringSource("a", "ERROR NOTICE FATAL\n"))
+
+	for _, config := range []string{
+		`{ filter: { name: a regexp: "(a)" properties: { 1: { style: error } } } apply: { filters: a } }`,
+		`{ style: { name: a color: red } style: { name: a color: blue } }`,
+		`{ style: { color: red } }`,
+	} {
+		if _, err := createProgram(strings.NewReader(config)); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	prog, err := createProgram(strings.NewReader(`{
+		style: { name: unused color: red }
+		filter: { name: a regexp: "a" }
+		apply: { filters: a }
+	}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, warning := range prog.check("") {
+		fmt.Println(warning)
+	}
+	// Output:
+	// fg:white,bg:red,mod:[bold]              {ERROR}
+	// fg:none,bg:none,mod:[]                  { }
+	// fg:white,bg:blue,mod:[bold]             {NOTICE}
+	// fg:none,bg:none,mod:[]                  { }
+	// fg:white,bg:red,mod:[underline]         {FATAL}
+	// fg:none,bg:none,mod:[]                  {
+	// }
+	// 1:60: undefined style "error"
+	// 1:47: duplicate style "a", first defined at 1:17
+	// 1:9: missing parameter "name"
+	// 2:31: warning: style "unused" is never used
 }
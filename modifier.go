@@ -11,16 +11,18 @@ const (
 	modifierUnderline
 	modifierReverse
 	modifierBlink
+	modifierDim
 )
 
 const firstModifier = modifierBold
-const lastModifier = modifierBlink
+const lastModifier = modifierDim
 
 var itoaModifier = map[modifier]string{
 	modifierBold:      "bold",
 	modifierUnderline: "underline",
 	modifierReverse:   "reverse",
 	modifierBlink:     "blink",
+	modifierDim:       "dim",
 }
 
 var atoiModifier = func() map[string]modifier {
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/johan-bolmsjo/rainbow/internal/ansiterm"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// processor applies a program to lines of input and writes the result.
+type processor struct {
+	prog         *program
+	w            *bufio.Writer
+	encoder      textEncoder
+	prefixSource bool     // Prefix output lines with the name of their source
+	numberLines  bool     // Prefix output lines with their line number
+	timeFormat   string   // Prefix output lines with the time they were read in this format, empty for none
+	maxLineLen   int      // Maximum line length in bytes, 0 for unlimited
+	truncate     bool     // Truncate rather than split lines longer than maxLineLen
+	splitCR      bool     // Bare carriage returns end lines
+	charset      *charset // Character set of input, the one of the program if nil
+	reloader     *configReloader
+	selection    selectionSpec
+	context      *lineContext    // Context around selected lines, nil for none
+	stats        *lineStats      // Statistics, nil if not collected
+	detector     *configDetector // Detects the program to use, nil once detected
+	line         *line
+	lineNumbers  map[*inputSource]int // Number of lines read from each source
+
+	partialTimeout time.Duration // Output incomplete lines after this idle time, 0 to disable
+	rerender       bool          // Output completed partial lines again rather than appending the rest
+	partial        partialLine
+	overwrite      bool // Last output line ended with a bare carriage return
+}
+
+// partialLine is an incomplete line that has been output.
+type partialLine struct {
+	src *inputSource // nil if none
+	len int          // Length of output text
+}
+
+func newProcessor(prog *program, w *bufio.Writer, encoder textEncoder) *processor {
+	return &processor{
+		prog:    prog,
+		w:       w,
+		encoder: encoder,
+		line:    newLine(),
+
+		lineNumbers: map[*inputSource]int{},
+	}
+}
+
+// processSource opens and processes all lines of src.
+func (p *processor) processSource(src *inputSource) error {
+	if p.partialTimeout > 0 {
+		return p.processConcurrently([]*inputSource{src})
+	}
+
+	r, err := src.open()
+	if err != nil {
+		return fmt.Errorf("failed to open input: %s", err)
+	}
+	defer r.Close()
+	return p.process(src, r)
+}
+
+// process applies the program to each line read from r and writes the result.
+// The output is flushed after each line.
+func (p *processor) process(src *inputSource, r io.Reader) error {
+	lr := p.newLineReader(r)
+	for {
+		// The byte slice for the line content is uniquely allocated for each line
+		// as it's saved in a match history for match comparisons.
+		text, end, err := lr.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %s", src.name, err)
+		}
+		if err = p.processLine(src, text, end, time.Now()); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *processor) newLineReader(r io.Reader) *lineReader {
+	lr := newLineReader(r, p.maxLineLen, p.truncate)
+	lr.splitCR = p.splitCR
+	return lr
+}
+
+// processConcurrently reads all sources at the same time. Lines are processed
+// in the order they arrive, the order of lines from each individual source is
+// retained. Incomplete lines are output if no more data arrives within the
+// partial line timeout.
+func (p *processor) processConcurrently(sources []*inputSource) error {
+	type event struct {
+		src      *inputSource
+		text     []byte
+		end      lineEnd
+		received time.Time
+		err      error
+		done     bool   // Source has been read to the end or failed
+		waiting  bool   // Source is waiting for the rest of an incomplete line
+		pending  []byte // Incomplete line read when the source started waiting
+	}
+
+	events := make(chan event)
+	for _, src := range sources {
+		go func() {
+			r, err := src.open()
+			if err != nil {
+				events <- event{err: fmt.Errorf("failed to open input: %s", err), done: true}
+				return
+			}
+			defer r.Close()
+
+			lr := p.newLineReader(r)
+			if p.partialTimeout > 0 {
+				// The incomplete line is copied by the reader as it may
+				// complete the line before the timer expires.
+				lr.waiting = func(pending []byte) {
+					events <- event{src: src, waiting: true, pending: pending}
+				}
+			}
+			for {
+				text, end, err := lr.readLine()
+				if err == io.EOF {
+					events <- event{done: true}
+					return
+				} else if err != nil {
+					events <- event{err: fmt.Errorf("failed to read %s: %s", src.name, err), done: true}
+					return
+				}
+				events <- event{src: src, text: text, end: end, received: time.Now()}
+			}
+		}()
+	}
+
+	// Sources waiting for the rest of a line, each with the incomplete line
+	// and when to output it. The timer runs until the first of them while any
+	// source is waiting.
+	type waitingSource struct {
+		pending  []byte
+		deadline time.Time
+	}
+	waiting := map[*inputSource]waitingSource{}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	resetTimer := func() {
+		timer.Stop()
+		var first time.Time
+		for _, w := range waiting {
+			if first.IsZero() || w.deadline.Before(first) {
+				first = w.deadline
+			}
+		}
+		if !first.IsZero() {
+			timer.Reset(time.Until(first))
+		}
+	}
+
+	for n := len(sources); n > 0; {
+		select {
+		case ev := <-events:
+			if ev.done {
+				if ev.err != nil {
+					return ev.err
+				}
+				n--
+				continue
+			}
+			if ev.waiting {
+				waiting[ev.src] = waitingSource{pending: ev.pending, deadline: time.Now().Add(p.partialTimeout)}
+				resetTimer()
+				continue
+			}
+			if _, ok := waiting[ev.src]; ok {
+				delete(waiting, ev.src)
+				resetTimer()
+			}
+			if err := p.processLine(ev.src, ev.text, ev.end, ev.received); err != nil {
+				return err
+			}
+
+		case now := <-timer.C:
+			// Output the incomplete lines in the order the sources started
+			// waiting.
+			var expired []*inputSource
+			for src, w := range waiting {
+				if !w.deadline.After(now) {
+					expired = append(expired, src)
+				}
+			}
+			sort.Slice(expired, func(i, j int) bool {
+				return waiting[expired[i]].deadline.Before(waiting[expired[j]].deadline)
+			})
+			for _, src := range expired {
+				err := p.outputPartial(src, waiting[src].pending)
+				delete(waiting, src)
+				if err != nil {
+					return fmt.Errorf("failed to output line: %s", err)
+				}
+			}
+			resetTimer()
+		}
+	}
+	return nil
+}
+
+func (p *processor) processLine(src *inputSource, text []byte, end lineEnd, received time.Time) error {
+	if p.detector != nil {
+		if !p.detector.add(src, text, end, received) {
+			return nil
+		}
+		return p.detectProgram()
+	}
+
+	if p.stats != nil {
+		p.stats.mu.Lock()
+		defer p.stats.mu.Unlock()
+		p.stats.lines++
+	}
+
+	if p.reloader != nil {
+		p.reloadProgram()
+	}
+
+	// The line object and its state objects are reused beteween each line.
+	text, invalid := p.inputCharset().decode(text)
+	p.initLine(src, text, invalid, end, received)
+	if end != lineEndSplit {
+		p.lineNumbers[src]++
+	}
+
+	if err := p.line.applyProgram(p.prog); err != nil {
+		return err
+	}
+
+	var err error
+	if p.partial.src == src {
+		err = p.completePartial()
+	} else {
+		if err = p.endPartial(); err == nil {
+			err = p.output()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to output line: %s", err)
+	}
+	return nil
+}
+
+// detectProgram detects the program to use from the lines read so far, then
+// processes them. It must be called at the end of input in case fewer lines
+// than needed for detection were read.
+func (p *processor) detectProgram() error {
+	d := p.detector
+	if d == nil {
+		return nil
+	}
+	p.detector = nil
+
+	prog, path := d.detect()
+	if p.stats != nil {
+		// Statistics of the program may be printed at any time.
+		p.stats.mu.Lock()
+	}
+	err := p.setProgram(prog)
+	if p.stats != nil {
+		p.stats.mu.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	if path != "" && d.detected != nil {
+		d.detected(path)
+	}
+
+	for _, l := range d.lines {
+		if err := p.processLine(l.src, l.text, l.end, l.received); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initLine initializes the current line with text converted to UTF-8. Lines
+// split in several parts share the same line number.
+func (p *processor) initLine(src *inputSource, text []byte, invalid []interval, end lineEnd, received time.Time) {
+	p.line.init(src, text, end)
+	p.line.invalid = invalid
+	p.line.number = p.lineNumbers[src] + 1
+	p.line.received = received
+}
+
+// inputCharset returns the character set of input.
+func (p *processor) inputCharset() *charset {
+	if p.charset != nil {
+		return p.charset
+	} else if p.prog.charset != nil {
+		return p.prog.charset
+	}
+	return charsetUTF8
+}
+
+// outputPartial outputs an incomplete line. The line is completed when the
+// rest of it has been read. Partial lines are not output when selecting lines
+// as it's not known if the complete line will be selected, nor while detecting
+// the program as lines read before are not yet output.
+func (p *processor) outputPartial(src *inputSource, text []byte) error {
+	text = p.inputCharset().trimIncomplete(text)
+	text, invalid := p.inputCharset().decode(text)
+	if len(text) == 0 || p.selection.enabled() || p.detector != nil ||
+		p.partial.src == src && len(text) <= p.partial.len {
+		return nil
+	}
+
+	if p.stats != nil {
+		p.stats.mu.Lock()
+		defer p.stats.mu.Unlock()
+	}
+
+	if p.partial.src != src {
+		if err := p.endPartial(); err != nil {
+			return err
+		}
+	}
+
+	if p.partial.src == src && !p.rerender {
+		if _, err := p.w.Write(text[p.partial.len:]); err != nil {
+			return err
+		}
+	} else {
+		if p.partial.src == src || p.overwrite && p.rerender {
+			if err := ansiterm.WriteEraseLine(p.w); err != nil {
+				return err
+			}
+		}
+		p.overwrite = false
+		p.initLine(src, text, invalid, lineEndPartial, time.Now())
+		if err := p.line.applyProgram(p.prog); err != nil {
+			return err
+		}
+		if err := p.writeLine(p.w, p.encoder); err != nil {
+			return err
+		}
+	}
+
+	p.partial = partialLine{src: src, len: len(text)}
+	return p.w.Flush()
+}
+
+// completePartial outputs the current line which has previously been output
+// as a partial line.
+func (p *processor) completePartial() error {
+	n := p.partial.len
+	p.partial = partialLine{}
+
+	if p.rerender {
+		if err := ansiterm.WriteEraseLine(p.w); err != nil {
+			return err
+		}
+		return p.output()
+	}
+
+	if _, err := p.w.Write(p.line.text[min(n, len(p.line.text)):]); err != nil {
+		return err
+	}
+	p.overwrite = p.line.end.bareCR()
+	if err := p.line.outputEnd(p.w, p.encoder); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// endPartial ends a partial line of another source with a newline to not mix
+// it with the line about to be output. The complete line is output in full
+// once read.
+func (p *processor) endPartial() error {
+	if p.partial.src == nil {
+		return nil
+	}
+	p.partial = partialLine{}
+	_, err := p.w.Write(bytesNewline)
+	return err
+}
+
+// reloadProgram swaps in a reloaded program. The current program is kept if
+// the reloaded one fails to load.
+func (p *processor) reloadProgram() {
+	prog, err := p.reloader.reload()
+	if err == nil && prog != nil {
+		if err = p.setProgram(prog); err == nil && p.stats != nil {
+			// The line being processed is counted by the reloaded program.
+			p.stats.reloadedLines = p.stats.lines - 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(errorStream, "failed to reload config: %s\n", err)
+	}
+}
+
+// setProgram sets the program to apply to lines, compiling the selection
+// specification for it.
+func (p *processor) setProgram(prog *program) error {
+	if p.selection.enabled() {
+		sel, err := p.selection.compile(prog)
+		if err != nil {
+			return err
+		}
+		prog.selection = sel
+	}
+	p.prog = prog
+	return nil
+}
+
+var (
+	bytesSourceSep = []byte(": ")
+	bytesNumberSep = []byte(":")
+	bytesSpace     = []byte(" ")
+
+	// Properties of line numbers and times in line prefixes.
+	linePrefixProps = properties{fgcolor: colorIBlack}
+)
+
+func (p *processor) output() error {
+	var err error
+	if p.context != nil {
+		err = p.context.output(p)
+	} else if p.line.selected {
+		err = p.overwriteLine()
+	}
+	if err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// overwriteLine writes the current line. A line following one that ended with
+// a bare carriage return replaces it, the rest of the replaced line is erased if
+// rendering for a terminal.
+func (p *processor) overwriteLine() error {
+	if p.overwrite && p.rerender {
+		if err := ansiterm.WriteEraseLine(p.w); err != nil {
+			return err
+		}
+	}
+	p.overwrite = p.line.end.bareCR()
+	return p.writeLine(p.w, p.encoder)
+}
+
+// writeLine writes the current line, including any prefix, using encoder.
+func (p *processor) writeLine(w io.Writer, encoder textEncoder) error {
+	var err error
+	var buf [64]byte
+
+	if p.timeFormat != "" {
+		if encoder, err = encoder(w, linePrefixProps, p.line.received.AppendFormat(buf[:0], p.timeFormat)); err != nil {
+			return err
+		}
+		if encoder, err = encoder(w, properties{}, bytesSpace); err != nil {
+			return err
+		}
+	}
+
+	if p.prefixSource {
+		src := p.line.src
+		if encoder, err = encoder(w, src.props, src.prefix); err != nil {
+			return err
+		}
+		if p.numberLines {
+			if encoder, err = encoder(w, properties{}, bytesNumberSep); err != nil {
+				return err
+			}
+		}
+	}
+	if p.numberLines {
+		if encoder, err = encoder(w, linePrefixProps, strconv.AppendInt(buf[:0], int64(p.line.number), 10)); err != nil {
+			return err
+		}
+	}
+	if p.prefixSource || p.numberLines {
+		if encoder, err = encoder(w, properties{}, bytesSourceSep); err != nil {
+			return err
+		}
+	}
+
+	return p.line.output(w, encoder)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profiles names the files to write profiles to, empty names are not profiled.
+type profiles struct {
+	cpu, mem, trace string
+}
+
+func (prof profiles) enabled() bool {
+	return prof.cpu != "" || prof.mem != "" || prof.trace != ""
+}
+
+// start starts profiling. The profiles are written when exiting using exit.
+// Being interrupted also exits this way to not lose profiles of input that
+// never ends, unless exitOnInterrupt is false because an interrupt is handled
+// otherwise. A wrapped command keeps running when interrupted and exits using
+// exit once it has exited.
+func (prof profiles) start(exitOnInterrupt bool) error {
+	if !prof.enabled() {
+		return nil
+	}
+
+	if prof.cpu != "" {
+		f, err := os.Create(prof.cpu)
+		if err != nil {
+			return err
+		}
+		if err = pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		atExit(func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	if prof.trace != "" {
+		f, err := os.Create(prof.trace)
+		if err != nil {
+			return err
+		}
+		if err = trace.Start(f); err != nil {
+			f.Close()
+			return err
+		}
+		atExit(func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	if prof.mem != "" {
+		// Created up front to fail early.
+		f, err := os.Create(prof.mem)
+		if err != nil {
+			return err
+		}
+		atExit(func() {
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(errorStream, "failed to write memory profile: %s\n", err)
+			}
+			f.Close()
+		})
+	}
+
+	if !exitOnInterrupt {
+		return nil
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		exit(130)
+	}()
+	return nil
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/johan-bolmsjo/rainbow/internal/igor"
 	"github.com/johan-bolmsjo/saft"
 	"io"
-	"os"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -17,21 +18,30 @@ type program struct {
 	filters           filterList
 	stms              []*apply
 	interp            *igor.Interp
+	line              *line          // Line currently being processed
+	selection         *selection     // Lines to output, all lines if nil
+	charset           *charset       // Default character set of input, nil for UTF-8
+	detect            *regexp.Regexp // Matches lines the config is meant for, nil if none
+	defs              definitions    // Values interpolated in strings
+	styles            styles         // Styles filter properties may be based on
+	includes          []string       // Paths of included config files
 }
 
 type apply struct {
-	cond    *igor.Cond // Apply filters if expression evaluates to true
-	filters filterList
+	defPos
+	cond         *igor.Cond // Apply filters if expression evaluates to true
+	filters      filterList
+	appliedLines int // Number of lines the filters were applied to, for statistics
 }
 
 func loadProgram(filename string) (*program, error) {
-	file, err := os.Open(filename)
+	file, err := openConfig(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	prog, err := createProgram(file)
+	prog, err := createProgramFile(file, filename)
 	if err != nil {
 		return nil, decorateErrorWithSource(err, filename)
 	}
@@ -40,6 +50,39 @@ func loadProgram(filename string) (*program, error) {
 }
 
 func createProgram(reader io.Reader) (*program, error) {
+	return createProgramFile(reader, "")
+}
+
+// createProgramFile creates a program from the config file read from reader.
+// Files included by the config are searched for relative to filename, unless
+// empty, and in the config search path.
+func createProgramFile(reader io.Reader, filename string) (*program, error) {
+	prog := newProgram("<stream>")
+
+	root, err := prog.parseConfig(reader, "", []string{filename})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = prog.checkFilterResults(); err != nil {
+		return nil, err
+	}
+
+	if len(prog.filters) == 0 {
+		return nil, missingParameterError(root, parFilter)
+	}
+	if len(prog.stms) == 0 {
+		return nil, missingParameterError(root, parApply)
+	}
+
+	return prog, nil
+}
+
+// parseConfig parses a config file into the program. The file is empty for
+// the config file being loaded, else the name of an included config file.
+// Included files are resolved relative to the last file in includeStack, the
+// chain of files including the file being parsed.
+func (prog *program) parseConfig(reader io.Reader, file string, includeStack []string) (*saft.Assoc, error) {
 	elems, err := saft.Parse(reader)
 	if err != nil {
 		return nil, err
@@ -56,9 +99,116 @@ func createProgram(reader io.Reader) (*program, error) {
 		return nil, err
 	}
 
-	prog := program{
-		name:   "<stream>",
+	if err = assocCheckDuplicates(root, parEncoding, parDetect); err != nil {
+		return nil, err
+	}
+
+	var cs *charset
+	for _, p := range root.L {
+		switch p.K.V {
+		case parEncoding:
+			str, err := elemExpectString(p.V, parEncoding)
+			if err != nil {
+				return nil, err
+			}
+			if cs, err = findCharset(str.V); err != nil {
+				return nil, posWrapError(err, str.Pos())
+			}
+		case parDetect:
+			str, err := elemExpectString(p.V, parDetect)
+			if err != nil {
+				return nil, err
+			}
+			value, used, err := prog.expand(str)
+			if err != nil {
+				return nil, err
+			}
+			detect, err := regexp.Compile(value)
+			if err != nil {
+				return nil, posWrapError(definitionsError(err, used), str.Pos())
+			}
+			// Included configs are not what is detected.
+			if file == "" {
+				prog.detect = detect
+			}
+		case parStyle:
+			if err := prog.parseStyle(p.V, file); err != nil {
+				return nil, err
+			}
+		case parDefine:
+			if err := prog.parseDefine(p.V, file); err != nil {
+				return nil, err
+			}
+		case parInclude:
+			if err := prog.parseInclude(p.V, includeStack); err != nil {
+				return nil, err
+			}
+		case parFilter:
+			if err := prog.parseFilter(p.V, file); err != nil {
+				return nil, err
+			}
+		case parApply:
+			if err := prog.parseApply(p.V, file); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, unknownParameterError(&p)
+		}
+	}
+
+	// The encoding of included configs is used unless set by the including one.
+	if cs != nil && (file == "" || prog.charset == nil) {
+		prog.charset = cs
+	}
+
+	return root, nil
+}
+
+// parseInclude parses a config file included by the file last in
+// includeStack.
+func (prog *program) parseInclude(elem saft.Elem, includeStack []string) error {
+	str, err := elemExpectString(elem, parInclude)
+	if err != nil {
+		return err
+	}
+	path, err := resolveInclude(str.V, includeStack[len(includeStack)-1])
+	if err != nil {
+		return posWrapError(err, str.Pos())
+	}
+	for i, included := range includeStack {
+		if included != "" && sameConfigFile(included, path) {
+			cycle := append(includeStack[i:len(includeStack):len(includeStack)], path)
+			return posErrorf(str.Pos(), "cyclic include: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	// A config included by several configs is only parsed once.
+	for _, included := range prog.includes {
+		if sameConfigFile(included, path) {
+			return nil
+		}
+	}
+
+	file, err := openConfig(path)
+	if err != nil {
+		return posWrapError(err, str.Pos())
+	}
+	defer file.Close()
+	prog.includes = append(prog.includes, path)
+
+	if _, err = prog.parseConfig(file, path, append(includeStack, path)); err != nil {
+		return posWrapError(decorateErrorWithSource(err, path), str.Pos())
+	}
+	return nil
+}
+
+// newProgram creates a program without any filters, it outputs lines as is.
+func newProgram(name string) *program {
+	prog := &program{
+		name:   name,
 		interp: igor.NewInterp(),
+		defs:   definitions{},
+		styles: styles{},
 	}
 
 	prog.interp.RegisterFunction("filter-match?", func(args []igor.Object) igor.Object {
@@ -79,10 +229,10 @@ func createProgram(reader io.Reader) (*program, error) {
 	})
 
 	prog.interp.RegisterFunction("filter-result", func(args []igor.Object) igor.Object {
-		if len(args) != 2 {
-			igor.Throw(igor.ExceptInvalidNumberOfArgs(len(args), "2"))
+		if len(args) < 2 || len(args) > 3 {
+			igor.Throw(igor.ExceptInvalidNumberOfArgs(len(args), "2-3"))
 		}
-		var strArgs [2]string
+		var strArgs [3]string
 		for i, arg := range args {
 			if arg, ok := arg.(igor.ObjectString); ok {
 				strArgs[i] = string(arg)
@@ -102,45 +252,93 @@ func createProgram(reader io.Reader) (*program, error) {
 			return igor.ObjectStringList(nil)
 		}
 
+		if len(args) == 3 {
+			group, ok := filter.findGroup(strArgs[2])
+			if !ok {
+				igor.Throw(igor.ExceptInvalidArgument(2, fmt.Sprintf("missing regexp group %q", strArgs[2])))
+			}
+			return filter.state.valueMatchResultGroup(idx, group)
+		}
 		return filter.state.valueMatchResultN(idx)
 	})
 
-	for _, p := range root.L {
-		switch p.K.V {
-		case parFilter:
-			if err := prog.parseFilter(p.V); err != nil {
-				return nil, err
+	prog.interp.RegisterFunction("line-range?", func(args []igor.Object) igor.Object {
+		if len(args) < 1 || len(args) > 2 {
+			igor.Throw(igor.ExceptInvalidNumberOfArgs(len(args), "1-2"))
+		}
+		bounds := [2]int{0, math.MaxInt}
+		for i, arg := range args {
+			str, ok := arg.(igor.ObjectString)
+			if !ok {
+				igor.Throw(igor.ExceptTypeError(arg, i, igor.TypeString))
 			}
-		case parApply:
-			if err := prog.parseApply(p.V); err != nil {
-				return nil, err
+			n, err := strconv.Atoi(string(str))
+			if err != nil {
+				igor.Throw(igor.ExceptInvalidArgument(i, fmt.Sprintf("invalid line number %q", string(str))))
 			}
-		default:
-			return nil, unknownParameterError(&p)
+			bounds[i] = n
 		}
-	}
+		return igor.ObjectBool(bounds[0] <= prog.line.number && prog.line.number <= bounds[1])
+	})
 
-	if len(prog.filters) == 0 {
-		return nil, missingParameterError(root, parFilter)
-	}
-	if len(prog.stms) == 0 {
-		return nil, missingParameterError(root, parApply)
-	}
+	prog.interp.RegisterFunction("source?", func(args []igor.Object) igor.Object {
+		for i, arg := range args {
+			if str, ok := arg.(igor.ObjectString); ok {
+				if prog.line.src.name == string(str) {
+					return igor.ObjectBool(true)
+				}
+			} else {
+				igor.Throw(igor.ExceptTypeError(arg, i, igor.TypeString))
+			}
+		}
+		return igor.ObjectBool(false)
+	})
 
-	return &prog, nil
+	return prog
 }
 
-func (prog *program) parseFilter(elem saft.Elem) error {
-	filter, err := elemParseFilter(elem, prog)
+func (prog *program) parseFilter(elem saft.Elem, file string) error {
+	filter, err := elemParseFilter(elem, prog, file)
 	if err == nil {
-		if prog.findFilter(filter.name) != nil {
-			return posErrorf(elem.Pos(), "duplicate filter %q", filter.name)
+		if prev := prog.filters.find(filter.name); prev != nil {
+			return posErrorf(elem.Pos(), "duplicate filter %q, first defined at %s", filter.name, prev.location())
 		}
 		prog.filters = append(prog.filters, filter)
 	}
 	return err
 }
 
+// checkFilterResults reports regexp groups that do not exist given to
+// filter-result in apply conditions. The filters may be defined after the
+// conditions using them so this is done once the config is parsed.
+func (prog *program) checkFilterResults() error {
+	var err error
+	for _, stm := range prog.stms {
+		stm.cond.Walk(func(call igor.Call) {
+			if err != nil || call.Name != "filter-result" || len(call.Args) != 3 {
+				return
+			}
+			name, ok1 := call.Args[0].(igor.ObjectString)
+			group, ok2 := call.Args[2].(igor.ObjectString)
+			if !ok1 || !ok2 {
+				return
+			}
+			if filter := prog.findFilter(string(name)); filter != nil {
+				if _, ok := filter.findGroup(string(group)); !ok {
+					err = posErrorf(call.Pos, "filter-result: filter %q has no regexp group %q", string(name), string(group))
+					if stm.file != "" {
+						err = decorateErrorWithSource(err, stm.file)
+					}
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (prog *program) findFilter(name string) *filter {
 	var filter *filter
 	filters := prog.filters
@@ -154,7 +352,7 @@ func (prog *program) findFilter(name string) *filter {
 	return filter
 }
 
-func (prog *program) parseApply(elem saft.Elem) error {
+func (prog *program) parseApply(elem saft.Elem, file string) error {
 	assoc, err := elem.ExpectAssoc()
 	if err != nil {
 		return err
@@ -163,7 +361,7 @@ func (prog *program) parseApply(elem saft.Elem) error {
 		return err
 	}
 
-	var apply apply
+	apply := apply{defPos: defPos{file, assoc.Pos()}}
 
 	for _, p := range assoc.L {
 		key := p.K.V
@@ -200,15 +398,22 @@ func (prog *program) parseApply(elem saft.Elem) error {
 }
 
 const (
-	parFilter            = "filter"
-	parFilterName        = "name"
-	parFilterRegexp      = "regexp"
-	parFilterRegexpFrom  = "regexpFrom"
-	parFilterProperties  = "properties"
-	parPropertyColor     = "color"
-	parPropertyBGColor   = "bgcolor"
-	parPropertyModifiers = "modifiers"
-	parApply             = "apply"
-	parApplyCond         = "cond"
-	parApplyFilters      = "filters"
+	parFilter               = "filter"
+	parFilterName           = "name"
+	parFilterRegexp         = "regexp"
+	parFilterRegexpFrom     = "regexpFrom"
+	parFilterProperties     = "properties"
+	parFilterPropertiesElse = "else"
+	parPropertyColor        = "color"
+	parPropertyBGColor      = "bgcolor"
+	parPropertyModifiers    = "modifiers"
+	parApply                = "apply"
+	parApplyCond            = "cond"
+	parApplyFilters         = "filters"
+	parEncoding             = "encoding"
+	parDetect               = "detect"
+	parInclude              = "include"
+	parDefine               = "define"
+	parStyle                = "style"
+	parStyleName            = "name"
 )
@@ -1,5 +1,9 @@
 package main
 
+import (
+	"sort"
+)
+
 // Apply function to go stdlib regexp result.
 func applyToRegexpResult(res [][]int, f func(group int, ival interval)) {
 	for _, a := range res {
@@ -8,3 +12,28 @@ func applyToRegexpResult(res [][]int, f func(group int, ival interval)) {
 		}
 	}
 }
+
+// uncoveredIntervals returns the non-empty intervals of a regexp match that no
+// matched group covers.
+func uncoveredIntervals(match []int) []interval {
+	var groups []interval
+	for i := 2; i < len(match); i += 2 {
+		if match[i] != -1 && match[i] < match[i+1] {
+			groups = append(groups, interval{match[i], match[i+1]})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].beg < groups[j].beg })
+
+	var uncovered []interval
+	pos := match[0]
+	for _, g := range groups {
+		if g.beg > pos {
+			uncovered = append(uncovered, interval{pos, g.beg})
+		}
+		pos = max(pos, g.end)
+	}
+	if pos < match[1] {
+		uncovered = append(uncovered, interval{pos, match[1]})
+	}
+	return uncovered
+}
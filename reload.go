@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Interval between checks of the config file modification time.
+const reloadPollInterval = time.Second
+
+// configReloader requests the program to be reloaded when rainbow receives
+// SIGHUP or when the modification time of the config file, or of any config
+// file it includes, changes.
+type configReloader struct {
+	filename string
+	pending  atomic.Bool // Reload requested
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time // Modification times of the watched config files
+}
+
+// newConfigReloader creates a reloader of the config file the program was
+// loaded from.
+func newConfigReloader(filename string, prog *program) *configReloader {
+	cr := &configReloader{filename: filename}
+	cr.watch(prog)
+	return cr
+}
+
+// watch watches the config file and the config files included by the program
+// loaded from it. Files that can not be found are watched for being created.
+func (cr *configReloader) watch(prog *program) {
+	modTimes := map[string]time.Time{}
+	for _, filename := range append([]string{cr.filename}, prog.includes...) {
+		var modTime time.Time
+		if info, err := os.Stat(filename); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes[filename] = modTime
+	}
+
+	cr.mu.Lock()
+	cr.modTimes = modTimes
+	cr.mu.Unlock()
+}
+
+// start watches for reload requests in the background.
+func (cr *configReloader) start() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(reloadPollInterval)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				cr.pending.Store(true)
+			case <-ticker.C:
+				cr.checkModified()
+			}
+		}
+	}()
+}
+
+// checkModified requests a reload if the modification time of any watched
+// config file has changed.
+func (cr *configReloader) checkModified() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	for filename, modTime := range cr.modTimes {
+		var newModTime time.Time
+		if info, err := os.Stat(filename); err == nil {
+			newModTime = info.ModTime()
+		}
+		if !newModTime.Equal(modTime) {
+			cr.modTimes[filename] = newModTime
+			cr.pending.Store(true)
+		}
+	}
+}
+
+// reload loads the program again if a reload has been requested. A nil program
+// is returned if no reload was requested. The files included by the reloaded
+// program are watched from then on.
+func (cr *configReloader) reload() (*program, error) {
+	if !cr.pending.Swap(false) {
+		return nil, nil
+	}
+	prog, err := loadProgram(cr.filename)
+	if err != nil {
+		return nil, err
+	}
+	cr.watch(prog)
+	return prog, nil
+}
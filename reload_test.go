@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with a modification time that differs from
+// any earlier one, which file systems with a coarse time resolution may not
+// give two writes in a row.
+func writeConfig(t *testing.T, path, config string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.rainbow")
+	included := filepath.Join(dir, "common.rainbow")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeConfig(t, included, `{ filter: { name: a regexp: "a" } }`, modTime)
+	writeConfig(t, path, `{ include: common apply: { filters: a } }`, modTime)
+	prog, err := loadProgram(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errors, err := os.CreateTemp(dir, "errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stream *os.File) { errorStream = stream }(errorStream)
+	errorStream = errors
+
+	proc := newProcessor(prog, bufio.NewWriter(io.Discard), textEncoderDummy)
+	proc.reloader = newConfigReloader(path, prog)
+
+	proc.reloadProgram()
+	if proc.prog != prog {
+		t.Fatal("program reloaded without a request")
+	}
+
+	writeConfig(t, included, `{ filter: { name: b regexp: "b" } }`, modTime.Add(time.Minute))
+	writeConfig(t, path, `{ include: common apply: { filters: b } }`, modTime.Add(time.Minute))
+	proc.reloader.pending.Store(true)
+	proc.reloadProgram()
+	if proc.prog == prog || proc.prog.findFilter("b") == nil {
+		t.Fatal("program not reloaded")
+	}
+	prog = proc.prog
+
+	// Editing an included config requests a reload.
+	proc.reloader.checkModified()
+	if proc.reloader.pending.Load() {
+		t.Fatal("reload requested without any change")
+	}
+	writeConfig(t, included, `{ filter: { name: b regexp: "B" } }`, modTime.Add(2*time.Minute))
+	proc.reloader.checkModified()
+	proc.reloadProgram()
+	if proc.prog == prog || proc.prog.findFilter("b").regexp.String() != "B" {
+		t.Fatal("program not reloaded after editing included config")
+	}
+	prog = proc.prog
+
+	// An invalid config keeps the current program.
+	writeConfig(t, path, `{ apply: { filters: c } }`, modTime.Add(3*time.Minute))
+	proc.reloader.checkModified()
+	proc.reloadProgram()
+	if proc.prog != prog {
+		t.Fatal("invalid config replaced the program")
+	}
+	output, err := os.ReadFile(errors.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "failed to reload config") {
+		t.Fatalf("got error output %q", output)
+	}
+}
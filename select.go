@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/johan-bolmsjo/errors"
+	"github.com/johan-bolmsjo/rainbow/internal/igor"
+	"github.com/johan-bolmsjo/saft"
+	"strings"
+)
+
+// selectionSpec specifies what lines to output, like grep. It's compiled for
+// each loaded program as it refers to filters by name.
+type selectionSpec struct {
+	filters []string // Select lines matched by any of these filters
+	cond    string   // Select lines for which this expression is true
+	invert  bool     // Select lines not selected by the above
+}
+
+// selection is a selection specification compiled for a program.
+type selection struct {
+	filters []*filter
+	cond    *igor.Cond
+	invert  bool
+}
+
+func (spec *selectionSpec) enabled() bool {
+	return len(spec.filters) > 0 || spec.cond != "" || spec.invert
+}
+
+func (spec *selectionSpec) compile(prog *program) (*selection, error) {
+	sel := selection{invert: spec.invert}
+
+	for _, name := range spec.filters {
+		filter := prog.findFilter(name)
+		if filter == nil {
+			return nil, fmt.Errorf("selected filter %q does not exist", name)
+		}
+		sel.filters = append(sel.filters, filter)
+	}
+
+	if spec.cond != "" {
+		elems, err := saft.Parse(strings.NewReader(spec.cond))
+		if err == nil && len(elems) != 1 {
+			err = errors.New("expected one expression")
+		}
+		if err == nil {
+			sel.cond, err = prog.interp.CompileCond(elems[0])
+		}
+		if err != nil {
+			return nil, decorateErrorWithSource(err, "selection condition")
+		}
+	}
+
+	return &sel, nil
+}
+
+// selects reports if the line is selected. It must be called after the
+// program has been applied to the line but before the filter state is cleared.
+func (sel *selection) selects(l *line) (bool, error) {
+	if sel == nil {
+		return true, nil
+	}
+
+	selected := false
+	for _, f := range sel.filters {
+		if selected = l.matchFilter(f); selected {
+			break
+		}
+	}
+	if !selected && sel.cond != nil {
+		var err error
+		if selected, err = sel.cond.Eval(); err != nil {
+			return false, err
+		}
+	}
+	return selected != sel.invert, nil
+}
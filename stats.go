@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// lineStats collects statistics of processed lines. Per filter and apply
+// clause statistics are kept by the program.
+type lineStats struct {
+	mu    sync.Mutex // Held while processing a line
+	start time.Time
+	lines int
+
+	// Lines processed before the program was last reloaded. Per filter and
+	// apply clause statistics are reset when the program is reloaded.
+	reloadedLines int
+}
+
+func newLineStats() *lineStats {
+	return &lineStats{start: time.Now()}
+}
+
+// printStatsOnSignal prints statistics to w when rainbow receives any of the
+// statistics signals (SIGUSR1 where available).
+func (p *processor) printStatsOnSignal(w io.Writer) {
+	if len(statsSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, statsSignals...)
+	go func() {
+		for range signals {
+			p.printStats(w)
+		}
+	}()
+}
+
+// printStats prints the number of processed lines and how many lines each
+// filter matched and each apply clause was applied to.
+func (p *processor) printStats(w io.Writer) error {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+
+	prog := p.prog
+	elapsed := time.Since(p.stats.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.stats.lines) / elapsed.Seconds()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d lines in %s, %.1f lines/s\n\n", p.stats.lines, elapsed.Round(time.Millisecond), rate)
+	if p.stats.reloadedLines > 0 {
+		fmt.Fprintf(tw, "config reloaded, counting the last %d lines\n\n", p.stats.lines-p.stats.reloadedLines)
+	}
+
+	fmt.Fprintf(tw, "FILTER\tPOSITION\tMATCHED LINES\n")
+	var printFilter func(path string, f *filter)
+	printFilter = func(path string, f *filter) {
+		name := f.name
+		if name == "" {
+			name = "-"
+		}
+		if path != "" {
+			name = path + filterSep + name
+		}
+		if f.regexp != nil || f.regexpFrom != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", name, f.pos.String(), f.state.matchedLines)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t-\n", name, f.pos.String())
+		}
+		for _, nested := range f.filters {
+			printFilter(name, nested)
+		}
+	}
+	for _, f := range prog.filters {
+		printFilter("", f)
+	}
+
+	fmt.Fprintf(tw, "\nAPPLY\tPOSITION\tAPPLIED LINES\n")
+	for i, stm := range prog.stms {
+		fmt.Fprintf(tw, "%d\t%s\t%d\n", i+1, stm.pos.String(), stm.appliedLines)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+var statsSignals []os.Signal
@@ -0,0 +1,10 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var statsSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/johan-bolmsjo/saft"
+)
+
+// style is a named set of properties that filter properties may be based on.
+type style struct {
+	defPos
+	name  string
+	props properties
+	used  bool // Referenced by properties
+}
+
+// styles are indexed by name.
+type styles map[string]*style
+
+func (prog *program) parseStyle(elem saft.Elem, file string) error {
+	assoc, err := elemExpectAssoc(elem, parStyle)
+	if err != nil {
+		return err
+	}
+
+	var name *saft.String
+	props, err := assocParseProperties(assoc, prog, &name)
+	if err != nil {
+		return err
+	}
+	if name == nil {
+		return missingParameterError(assoc, parStyleName)
+	}
+	if prev := prog.styles[name.V]; prev != nil {
+		return posErrorf(name.Pos(), "duplicate style %q, first defined at %s", name.V, prev.location())
+	}
+	prog.styles[name.V] = &style{name: name.V, props: props, defPos: defPos{file, name.Pos()}}
+	return nil
+}
+
+// findStyle finds a style referenced by properties.
+func (prog *program) findStyle(str *saft.String) (*style, error) {
+	s := prog.styles[str.V]
+	if s == nil {
+		return nil, posErrorf(str.Pos(), "undefined style %q", str.V)
+	}
+	s.used = true
+	return s, nil
+}
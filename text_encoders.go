@@ -82,6 +82,8 @@ func textEncoderANSI(w io.Writer, props properties, text []byte) (textEncoder, e
 				code = ansiterm.CodeReverseVideo
 			case modifierBlink:
 				code = ansiterm.CodeSlowBlink
+			case modifierDim:
+				code = ansiterm.CodeFaint
 			}
 			if code != ansiterm.CodeReset {
 				codes = append(codes, code)